@@ -0,0 +1,143 @@
+package iotagentsdk
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	u "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants
+const (
+	urlAdminLog = "/admin/log"
+)
+
+// AgentLogLevel is the log level of the IoT Agent.
+type AgentLogLevel string
+
+// Log levels of the IoT Agent, from the least to the most verbose.
+const (
+	AgentLogLevelFatal AgentLogLevel = "FATAL"
+	AgentLogLevelError AgentLogLevel = "ERROR"
+	AgentLogLevelWarn  AgentLogLevel = "WARN"
+	AgentLogLevelInfo  AgentLogLevel = "INFO"
+	AgentLogLevelDebug AgentLogLevel = "DEBUG"
+	// AgentLogLevelWarning is the spelling of AgentLogLevelWarn documented for /admin/log.
+	AgentLogLevelWarning AgentLogLevel = "WARNING"
+)
+
+// agentLogLevels are all log levels ordered by verbosity.
+var agentLogLevels = []AgentLogLevel{AgentLogLevelFatal, AgentLogLevelError, AgentLogLevelWarn, AgentLogLevelInfo, AgentLogLevelDebug}
+
+// verbosity returns the position of l in agentLogLevels, -1 if l is unknown.
+func (l AgentLogLevel) verbosity() int {
+	if strings.EqualFold(string(l), string(AgentLogLevelWarning)) {
+		l = AgentLogLevelWarn
+	}
+	for idx, level := range agentLogLevels {
+		if strings.EqualFold(string(l), string(level)) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Valid reports if l is a known log level.
+func (l AgentLogLevel) Valid() bool {
+	return l.verbosity() >= 0
+}
+
+// Response struct for reading the log level
+type respAgentLogLevel struct {
+	Level AgentLogLevel `json:"level"`
+}
+
+// GetAgentLogLevel returns the current log level of the IoT Agent.
+func (i IoTA) GetAgentLogLevel() (AgentLogLevel, error) {
+	return i.GetAgentLogLevelCtx(context.Background())
+}
+
+// GetAgentLogLevelCtx is like GetAgentLogLevel but uses the given context for the request.
+func (i IoTA) GetAgentLogLevelCtx(ctx context.Context) (AgentLogLevel, error) {
+	var resp respAgentLogLevel
+	err := i.do(ctx, request{
+		op:     "GetAgentLogLevel",
+		method: http.MethodGet,
+		url:    i.url(urlAdminLog),
+		status: http.StatusOK,
+		out:    &resp,
+	})
+	if err != nil {
+		return "", err
+	}
+	return AgentLogLevel(strings.ToUpper(string(resp.Level))), nil
+}
+
+// SetAgentLogLevel sets the log level of the IoT Agent.
+func (i IoTA) SetAgentLogLevel(level AgentLogLevel) error {
+	return i.SetAgentLogLevelCtx(context.Background(), level)
+}
+
+// SetAgentLogLevelCtx is like SetAgentLogLevel but uses the given context for the request.
+func (i IoTA) SetAgentLogLevelCtx(ctx context.Context, level AgentLogLevel) error {
+	if !level.Valid() {
+		return fmt.Errorf("Unknown log level: %s", level)
+	}
+	return i.setAgentLogLevel(ctx, level)
+}
+
+// setAgentLogLevel sets the log level of the IoT Agent without checking that it is known,
+// e.g. to restore a level reported by the agent.
+func (i IoTA) setAgentLogLevel(ctx context.Context, level AgentLogLevel) error {
+	query := u.Values{}
+	query.Set("level", strings.ToUpper(string(level)))
+	return i.do(ctx, request{
+		op:     "SetAgentLogLevel",
+		method: http.MethodPut,
+		url:    i.url(urlAdminLog) + "?" + query.Encode(),
+		status: http.StatusOK,
+	})
+}
+
+// RaiseAgentLogLevel raises the log level of the IoT Agent to level for the duration d,
+// then restores the previous level. If the agent already logs at least as verbose as level,
+// nothing is changed. The returned function restores the previous level early, calling it
+// more than once or after d has passed does nothing.
+func (i IoTA) RaiseAgentLogLevel(ctx context.Context, level AgentLogLevel, d time.Duration) (func(context.Context) error, error) {
+	if !level.Valid() {
+		return nil, fmt.Errorf("Unknown log level: %s", level)
+	}
+	previous, err := i.GetAgentLogLevelCtx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading log level: %w", err)
+	}
+	if previous.verbosity() >= level.verbosity() {
+		return func(context.Context) error { return nil }, nil
+	}
+	err = i.SetAgentLogLevelCtx(ctx, level)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	restore := func(ctx context.Context) error {
+		var err error
+		once.Do(func() { err = i.setAgentLogLevel(ctx, previous) })
+		return err
+	}
+	timer := time.AfterFunc(d, func() {
+		err := restore(context.Background())
+		if err != nil {
+			i.log(context.Background(), slog.LevelError, "Error while restoring log level of IoT Agent",
+				"host", i.Host, "level", previous, "error", err)
+		}
+	})
+	return func(ctx context.Context) error {
+		timer.Stop()
+		return restore(ctx)
+	}, nil
+}
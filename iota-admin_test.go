@@ -0,0 +1,158 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+// newAdminServer returns a server implementing /admin/log starting at level.
+func newAdminServer(t *testing.T, level string) (*httptest.Server, func() string) {
+	t.Helper()
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/admin/log" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPut {
+			level = r.URL.Query().Get("level")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Write([]byte(`{"level":"` + level + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return level
+	}
+}
+
+func TestAgentLogLevel(t *testing.T) {
+	srv, current := newAdminServer(t, "info")
+	iotaAdmin := newTestIoTA(t, srv.URL)
+
+	level, err := iotaAdmin.GetAgentLogLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != i.AgentLogLevelInfo {
+		t.Errorf("Expected INFO, got %s", level)
+	}
+
+	err = iotaAdmin.SetAgentLogLevel(i.AgentLogLevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current() != "DEBUG" {
+		t.Errorf("Expected DEBUG, got %s", current())
+	}
+
+	err = iotaAdmin.SetAgentLogLevel("VERBOSE")
+	if err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
+
+func TestRaiseAgentLogLevel(t *testing.T) {
+	srv, current := newAdminServer(t, "ERROR")
+	iotaAdmin := newTestIoTA(t, srv.URL)
+
+	_, err := iotaAdmin.RaiseAgentLogLevel(context.Background(), i.AgentLogLevelDebug, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current() != "DEBUG" {
+		t.Errorf("Expected DEBUG, got %s", current())
+	}
+	deadline := time.Now().Add(time.Second)
+	for current() != "ERROR" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if current() != "ERROR" {
+		t.Errorf("Expected level to be restored to ERROR, got %s", current())
+	}
+}
+
+func TestRaiseAgentLogLevelRestoreUnknown(t *testing.T) {
+	for _, previous := range []string{"WARNING", "TRACE"} {
+		t.Run(previous, func(t *testing.T) {
+			srv, current := newAdminServer(t, previous)
+			iotaAdmin := newTestIoTA(t, srv.URL)
+
+			restore, err := iotaAdmin.RaiseAgentLogLevel(context.Background(), i.AgentLogLevelDebug, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current() != "DEBUG" {
+				t.Errorf("Expected DEBUG, got %s", current())
+			}
+			err = restore(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current() != previous {
+				t.Errorf("Expected level to be restored to %s, got %s", previous, current())
+			}
+		})
+	}
+}
+
+func TestAgentLogLevelWarning(t *testing.T) {
+	if !i.AgentLogLevelWarning.Valid() || !i.AgentLogLevel("warning").Valid() {
+		t.Error("Expected WARNING to be valid")
+	}
+	srv, _ := newAdminServer(t, "WARNING")
+	// WARNING is as verbose as WARN, nothing to raise
+	restore, err := newTestIoTA(t, srv.URL).RaiseAgentLogLevel(context.Background(), i.AgentLogLevelWarn, time.Minute)
+	if err != nil || restore(context.Background()) != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestRaiseAgentLogLevelRestoreEarly(t *testing.T) {
+	srv, current := newAdminServer(t, "WARN")
+	iotaAdmin := newTestIoTA(t, srv.URL)
+
+	restore, err := iotaAdmin.RaiseAgentLogLevel(context.Background(), i.AgentLogLevelDebug, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current() != "WARN" {
+		t.Errorf("Expected WARN, got %s", current())
+	}
+	err = restore(context.Background())
+	if err != nil {
+		t.Errorf("Expected second restore to do nothing, got %v", err)
+	}
+}
+
+func TestRaiseAgentLogLevelAlreadyVerbose(t *testing.T) {
+	srv, current := newAdminServer(t, "DEBUG")
+	iotaAdmin := newTestIoTA(t, srv.URL)
+
+	restore, err := iotaAdmin.RaiseAgentLogLevel(context.Background(), i.AgentLogLevelInfo, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current() != "DEBUG" {
+		t.Errorf("Expected level not to be lowered, got %s", current())
+	}
+	err = restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,289 @@
+package iotagentsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Constants
+const (
+	urlMetrics            = "/metrics"
+	contentPrometheusText = "text/plain; version=0.0.4"
+	// labelService is the label of the text samples holding the fiware-service.
+	labelService = "service"
+)
+
+// AgentMetricName is the name of a metric published by the IoT Agent.
+type AgentMetricName string
+
+// Metrics published by the IoT Agent.
+const (
+	MetricDeviceCreationRequests AgentMetricName = "deviceCreationRequests"
+	MetricDeviceRemovalRequests  AgentMetricName = "deviceRemovalRequests"
+	MetricMeasureRequests        AgentMetricName = "measureRequests"
+)
+
+// AgentCounters are the values of the metrics of the IoT Agent by name.
+// Metrics unknown to the SDK are included as well.
+type AgentCounters map[AgentMetricName]float64
+
+// AgentMetrics is a sample of the metrics published by the IoT Agent on /metrics.
+type AgentMetrics struct {
+	// Services holds the metrics per fiware-service.
+	Services map[string]AgentCounters `json:"services"`
+	// Sum holds the metrics summed over all services.
+	Sum AgentCounters `json:"sum"`
+	// SampledAt is the time the metrics were received.
+	SampledAt time.Time `json:"-"`
+}
+
+// Metrics returns the metrics of the IoT Agent, requested in JSON form.
+func (i IoTA) Metrics() (*AgentMetrics, error) {
+	return i.MetricsCtx(context.Background())
+}
+
+// MetricsCtx is like Metrics but uses the given context for the request.
+func (i IoTA) MetricsCtx(ctx context.Context) (*AgentMetrics, error) {
+	return i.agentMetrics(ctx, "application/json", ParseAgentMetricsJSON)
+}
+
+// MetricsText returns the metrics of the IoT Agent, requested in Prometheus text form.
+func (i IoTA) MetricsText() (*AgentMetrics, error) {
+	return i.MetricsTextCtx(context.Background())
+}
+
+// MetricsTextCtx is like MetricsText but uses the given context for the request.
+func (i IoTA) MetricsTextCtx(ctx context.Context) (*AgentMetrics, error) {
+	return i.agentMetrics(ctx, contentPrometheusText, ParseAgentMetricsText)
+}
+
+// agentMetrics requests the metrics of the IoT Agent in the accepted form and parses them with parse.
+func (i IoTA) agentMetrics(ctx context.Context, accept string, parse func(data []byte) (*AgentMetrics, error)) (*AgentMetrics, error) {
+	var body []byte
+	var m *AgentMetrics
+	err := i.do(ctx, request{
+		op:     "Metrics",
+		method: http.MethodGet,
+		url:    i.url(urlMetrics),
+		status: http.StatusOK,
+		header: http.Header{"Accept": {accept}},
+		out:    &body,
+		decode: func(body []byte) (err error) {
+			m, err = parse(body)
+			return err
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		// A middleware answered without sending the request
+		m, err = parse(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.SampledAt = time.Now()
+	return m, nil
+}
+
+// ParseAgentMetricsJSON parses the metrics of the IoT Agent in JSON form.
+func ParseAgentMetricsJSON(data []byte) (*AgentMetrics, error) {
+	var m AgentMetrics
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("Error while decoding metrics: %w", err)
+	}
+	m.fill()
+	return &m, nil
+}
+
+// ParseAgentMetricsText parses the metrics of the IoT Agent in Prometheus text form.
+// OpenMetrics is accepted as well: timestamps in seconds are converted, exemplars and the
+// _created and _info series are dropped.
+// Samples labeled with a service are accounted to that service, all others to the sum.
+// The _total suffix of counters is removed from the names.
+func ParseAgentMetricsText(data []byte) (*AgentMetrics, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(fromOpenMetrics(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Error while parsing metrics: %w", err)
+	}
+	m := AgentMetrics{Services: map[string]AgentCounters{}}
+	for familyName, family := range families {
+		name := AgentMetricName(strings.TrimSuffix(familyName, "_total"))
+		for _, metric := range family.GetMetric() {
+			value, ok := sampleValue(metric)
+			if !ok {
+				continue
+			}
+			service := ""
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == labelService {
+					service = label.GetValue()
+				}
+			}
+			if service == "" {
+				if m.Sum == nil {
+					m.Sum = AgentCounters{}
+				}
+				m.Sum[name] += value
+				continue
+			}
+			if m.Services[service] == nil {
+				m.Services[service] = AgentCounters{}
+			}
+			m.Services[service][name] += value
+		}
+	}
+	m.fill()
+	return &m, nil
+}
+
+// fromOpenMetrics converts metrics in OpenMetrics text form to the Prometheus text form.
+// Lines already in Prometheus text form are kept as they are.
+func fromOpenMetrics(data []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && (fields[1] == "EOF" || fields[1] == "UNIT") {
+				continue
+			}
+			// The Prometheus text form knows no info, stateset, gaugehistogram and unknown types
+			if len(fields) >= 4 && fields[1] == "TYPE" && !slices.Contains([]string{"counter", "gauge", "histogram", "summary", "untyped"}, fields[3]) {
+				continue
+			}
+			out.WriteString(line + "\n")
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, rest := splitSample(line)
+		if strings.HasSuffix(name, "_created") || strings.HasSuffix(name, "_info") {
+			continue
+		}
+		series := line[:len(line)-len(rest)]
+		// Drop the exemplar, it follows the value and timestamp after a #
+		if idx := strings.Index(rest, "#"); idx >= 0 {
+			rest = rest[:idx]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 2 && strings.ContainsAny(fields[1], ".eE") {
+			// OpenMetrics timestamps are seconds, Prometheus ones milliseconds
+			if ts, err := strconv.ParseFloat(fields[1], 64); err == nil {
+				fields[1] = strconv.FormatInt(int64(math.Round(ts*1000)), 10)
+			}
+		}
+		out.WriteString(series + " " + strings.Join(fields, " ") + "\n")
+	}
+	return out.Bytes()
+}
+
+// splitSample splits a sample line into the metric name and the part following the name
+// and labels, which holds the value, timestamp and exemplar.
+func splitSample(line string) (string, string) {
+	end := strings.IndexAny(line, "{ \t")
+	if end < 0 {
+		return line, ""
+	}
+	name := line[:end]
+	if line[end] != '{' {
+		return name, line[end:]
+	}
+	quoted := false
+	for idx := end + 1; idx < len(line); idx++ {
+		switch {
+		case quoted && line[idx] == '\\':
+			idx++
+		case line[idx] == '"':
+			quoted = !quoted
+		case !quoted && line[idx] == '}':
+			return name, line[idx+1:]
+		}
+	}
+	return name, ""
+}
+
+// sampleValue returns the value of a counter, gauge or untyped sample.
+func sampleValue(metric *dto.Metric) (float64, bool) {
+	switch {
+	case metric.GetCounter() != nil:
+		return metric.GetCounter().GetValue(), true
+	case metric.GetGauge() != nil:
+		return metric.GetGauge().GetValue(), true
+	case metric.GetUntyped() != nil:
+		return metric.GetUntyped().GetValue(), true
+	}
+	return 0, false
+}
+
+// fill initializes missing maps and computes the sum over all services if the agent sent none.
+func (m *AgentMetrics) fill() {
+	if m.Services == nil {
+		m.Services = map[string]AgentCounters{}
+	}
+	if m.Sum != nil {
+		return
+	}
+	m.Sum = AgentCounters{}
+	for _, counters := range m.Services {
+		for name, value := range counters {
+			m.Sum[name] += value
+		}
+	}
+}
+
+// AgentMetricsRates are the rates per second of the metrics of the IoT Agent between two samples.
+type AgentMetricsRates struct {
+	// Interval is the time between the samples.
+	Interval time.Duration
+	Services map[string]AgentCounters
+	Sum      AgentCounters
+}
+
+// RatesSince computes the rates per second of all metrics between prev and m.
+// A metric smaller than in prev is considered reset by a restart of the agent and its
+// current value is used as increase.
+func (m AgentMetrics) RatesSince(prev AgentMetrics) (*AgentMetricsRates, error) {
+	interval := m.SampledAt.Sub(prev.SampledAt)
+	if interval <= 0 {
+		return nil, errors.New("Sample must be taken after the previous sample")
+	}
+	rates := AgentMetricsRates{
+		Interval: interval,
+		Services: map[string]AgentCounters{},
+		Sum:      counterRates(m.Sum, prev.Sum, interval),
+	}
+	for service, counters := range m.Services {
+		rates.Services[service] = counterRates(counters, prev.Services[service], interval)
+	}
+	return &rates, nil
+}
+
+// counterRates computes the rates per second from prev to cur.
+func counterRates(cur, prev AgentCounters, interval time.Duration) AgentCounters {
+	rates := AgentCounters{}
+	for name, value := range cur {
+		increase := value - prev[name]
+		if increase < 0 {
+			increase = value
+		}
+		rates[name] = increase / interval.Seconds()
+	}
+	return rates
+}
@@ -0,0 +1,162 @@
+package iotagentsdk_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+const agentMetricsJSON = `{
+	"services": {
+		"smartgondor": {"deviceCreationRequests": 2, "deviceRemovalRequests": 1, "measureRequests": 10},
+		"testing": {"deviceCreationRequests": 1, "measureRequests": 5}
+	},
+	"sum": {"deviceCreationRequests": 3, "deviceRemovalRequests": 1, "measureRequests": 15}
+}`
+
+const agentMetricsText = `# HELP deviceCreationRequests Device creation requests
+# TYPE deviceCreationRequests counter
+deviceCreationRequests_total{service="smartgondor"} 2
+deviceCreationRequests_total{service="testing"} 1
+# HELP measureRequests Measure requests
+# TYPE measureRequests counter
+measureRequests_total{service="smartgondor"} 10
+measureRequests_total{service="testing"} 5
+`
+
+// agentMetricsOpenMetrics holds the metrics of agentMetricsText in OpenMetrics form with
+// timestamps in seconds, _created series, an exemplar and an info metric.
+const agentMetricsOpenMetrics = `# TYPE build info
+build_info{version="4.3.0"} 1
+# HELP deviceCreationRequests Device creation requests
+# TYPE deviceCreationRequests counter
+# UNIT deviceCreationRequests requests
+deviceCreationRequests_total{service="smartgondor"} 2 1700000000.123
+deviceCreationRequests_created{service="smartgondor"} 1.6999e+09 1700000000.123
+deviceCreationRequests_total{service="testing"} 1 1700000000.123
+deviceCreationRequests_created{service="testing"} 1.6999e+09 1700000000.123
+# HELP measureRequests Measure requests
+# TYPE measureRequests counter
+measureRequests_total{service="smartgondor"} 10 1700000000.123 # {trace_id="a b#c"} 1 1700000000
+measureRequests_created{service="smartgondor"} 1.6999e+09
+measureRequests_total{service="test{}ing"} 5
+# EOF
+`
+
+func TestMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(agentMetricsJSON))
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "openmetrics") {
+			t.Errorf("Unexpected OpenMetrics in Accept %s", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(agentMetricsText))
+	}))
+	defer srv.Close()
+	iotaMetrics := newTestIoTA(t, srv.URL)
+
+	m, err := iotaMetrics.Metrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Services["smartgondor"][i.MetricMeasureRequests] != 10 || m.Sum[i.MetricDeviceCreationRequests] != 3 {
+		t.Errorf("Unexpected metrics %+v", m)
+	}
+	if m.SampledAt.IsZero() {
+		t.Error("Expected sample time to be set")
+	}
+
+	m, err = iotaMetrics.MetricsText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Services["testing"][i.MetricMeasureRequests] != 5 {
+		t.Errorf("Unexpected metrics %+v", m)
+	}
+	// No sum without service label, computed from the services
+	if m.Sum[i.MetricDeviceCreationRequests] != 3 || m.Sum[i.MetricMeasureRequests] != 15 {
+		t.Errorf("Unexpected sum %+v", m.Sum)
+	}
+}
+
+func TestParseAgentMetricsTextSum(t *testing.T) {
+	m, err := i.ParseAgentMetricsText([]byte("measureRequests 7\nmeasureRequests{service=\"a\"} 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Sum[i.MetricMeasureRequests] != 7 || m.Services["a"][i.MetricMeasureRequests] != 3 {
+		t.Errorf("Unexpected metrics %+v", m)
+	}
+}
+
+func TestParseAgentMetricsOpenMetrics(t *testing.T) {
+	m, err := i.ParseAgentMetricsText([]byte(agentMetricsOpenMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Services["smartgondor"][i.MetricMeasureRequests] != 10 || m.Services["test{}ing"][i.MetricMeasureRequests] != 5 ||
+		m.Sum[i.MetricDeviceCreationRequests] != 3 {
+		t.Errorf("Unexpected metrics %+v", m)
+	}
+	for name := range m.Sum {
+		if strings.HasSuffix(string(name), "_created") || strings.HasPrefix(string(name), "build") {
+			t.Errorf("Unexpected metric %s", name)
+		}
+	}
+	if len(m.Sum) != 2 {
+		t.Errorf("Unexpected metrics in sum %+v", m.Sum)
+	}
+}
+
+func TestAgentMetricsRatesSince(t *testing.T) {
+	prev, err := i.ParseAgentMetricsJSON([]byte(agentMetricsJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := i.ParseAgentMetricsJSON([]byte(`{
+		"services": {
+			"smartgondor": {"deviceCreationRequests": 2, "deviceRemovalRequests": 1, "measureRequests": 30},
+			"testing": {"deviceCreationRequests": 1, "measureRequests": 2}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev.SampledAt = time.Unix(100, 0)
+	cur.SampledAt = time.Unix(110, 0)
+
+	rates, err := cur.RatesSince(*prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates.Interval != 10*time.Second {
+		t.Errorf("Expected interval of 10s, got %s", rates.Interval)
+	}
+	if r := rates.Services["smartgondor"][i.MetricMeasureRequests]; r != 2 {
+		t.Errorf("Expected 2/s, got %v", r)
+	}
+	// Counter reset, the current value is the increase
+	if r := rates.Services["testing"][i.MetricMeasureRequests]; r != 0.2 {
+		t.Errorf("Expected 0.2/s, got %v", r)
+	}
+	if r := rates.Sum[i.MetricMeasureRequests]; r != 1.7 {
+		t.Errorf("Expected 1.7/s, got %v", r)
+	}
+
+	_, err = prev.RatesSince(*cur)
+	if err == nil {
+		t.Error("Expected error for samples in wrong order")
+	}
+}
@@ -0,0 +1,226 @@
+package iotagentsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headerAuthToken is the header carrying the token checked by the PEP proxy.
+const headerAuthToken = "X-Auth-Token"
+
+// TokenProvider provides the X-Auth-Token sent with every request to an IoT Agent
+// secured by a PEP proxy.
+type TokenProvider interface {
+	// Token returns a valid token for the given service.
+	Token(ctx context.Context, fs FiwareService) (string, error)
+	// Invalidate discards the token for the given service, e.g. because it was rejected.
+	Invalidate(fs FiwareService)
+}
+
+// WithTokenProvider sets the TokenProvider used to authenticate every request for a fiware-service.
+// If a token is rejected with 401, it is invalidated and the request is sent once more with a new token.
+func WithTokenProvider(tp TokenProvider) Option {
+	return func(i *IoTA) error {
+		if tp == nil {
+			return errors.New("Token provider cannot be nil")
+		}
+		i.tokenProvider = tp
+		return nil
+	}
+}
+
+// keystoneToken is a token issued by Keystone.
+type keystoneToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// KeystoneTokenProvider is a TokenProvider which gets tokens from Keystone using the password grant.
+// Tokens are cached per FiwareService until shortly before they expire.
+//
+// Tokens for a concrete service path are scoped to the project of that service path, all others
+// are scoped to the domain of the service.
+type KeystoneTokenProvider struct {
+	// URL is the base url of Keystone, e.g. "http://keystone:5001".
+	URL      string
+	User     string
+	Password string
+	// UserDomain is the domain of the user, the fiware-service is used if empty.
+	UserDomain string
+	// Client is the http client used for Keystone, http.DefaultClient is used if nil.
+	Client *http.Client
+	// ExpiryMargin is the time before the expiry at which a token is renewed.
+	ExpiryMargin time.Duration
+
+	mu      sync.Mutex
+	tokens  map[FiwareService]keystoneToken
+	fetches map[FiwareService]*tokenFetch
+}
+
+// tokenFetch is a request for a token in flight, shared by all callers for the same service.
+type tokenFetch struct {
+	done  chan struct{}
+	token keystoneToken
+	err   error
+}
+
+// NewKeystoneTokenProvider creates a new KeystoneTokenProvider.
+func NewKeystoneTokenProvider(keystoneURL, user, password string) *KeystoneTokenProvider {
+	return &KeystoneTokenProvider{
+		URL:          keystoneURL,
+		User:         user,
+		Password:     password,
+		ExpiryMargin: 30 * time.Second,
+		tokens:       make(map[FiwareService]keystoneToken),
+	}
+}
+
+// Token returns the cached token for fs or requests a new one from Keystone.
+func (k *KeystoneTokenProvider) Token(ctx context.Context, fs FiwareService) (string, error) {
+	for {
+		k.mu.Lock()
+		if token, ok := k.tokens[fs]; ok && k.valid(token) {
+			k.mu.Unlock()
+			return token.value, nil
+		}
+		if f, ok := k.fetches[fs]; ok {
+			// Another call is requesting a token for the service, wait for it
+			k.mu.Unlock()
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			if f.err == nil {
+				return f.token.value, nil
+			}
+			if ctx.Err() == nil && (errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded)) {
+				// The context of the other call ended, request a token with ours
+				continue
+			}
+			return "", f.err
+		}
+		f := &tokenFetch{done: make(chan struct{})}
+		if k.fetches == nil {
+			k.fetches = make(map[FiwareService]*tokenFetch)
+		}
+		k.fetches[fs] = f
+		k.mu.Unlock()
+
+		f.token, f.err = k.requestToken(ctx, fs)
+
+		k.mu.Lock()
+		delete(k.fetches, fs)
+		if f.err == nil {
+			if k.tokens == nil {
+				k.tokens = make(map[FiwareService]keystoneToken)
+			}
+			// Keep a token stored meanwhile if it lives longer
+			if existing, ok := k.tokens[fs]; ok && k.valid(existing) && existing.expiresAt.After(f.token.expiresAt) {
+				f.token = existing
+			}
+			k.tokens[fs] = f.token
+		}
+		k.mu.Unlock()
+		close(f.done)
+		if f.err != nil {
+			return "", f.err
+		}
+		return f.token.value, nil
+	}
+}
+
+// valid reports if the token can still be used.
+func (k *KeystoneTokenProvider) valid(token keystoneToken) bool {
+	return token.expiresAt.IsZero() || time.Now().Add(k.ExpiryMargin).Before(token.expiresAt)
+}
+
+// Invalidate discards the cached token for fs.
+func (k *KeystoneTokenProvider) Invalidate(fs FiwareService) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.tokens, fs)
+}
+
+// keystoneScope returns the scope of a token for fs.
+func keystoneScope(fs FiwareService) map[string]any {
+	domain := map[string]any{"name": fs.Service}
+	if fs.ServicePath == "" || fs.ServicePath == "/" || strings.ContainsAny(fs.ServicePath, "*,") {
+		return map[string]any{"domain": domain}
+	}
+	return map[string]any{"project": map[string]any{"domain": domain, "name": fs.ServicePath}}
+}
+
+// requestToken requests a new token for fs from Keystone.
+func (k *KeystoneTokenProvider) requestToken(ctx context.Context, fs FiwareService) (keystoneToken, error) {
+	userDomain := k.UserDomain
+	if userDomain == "" {
+		userDomain = fs.Service
+	}
+	reqBody := map[string]any{
+		"auth": map[string]any{
+			"identity": map[string]any{
+				"methods": []string{"password"},
+				"password": map[string]any{
+					"user": map[string]any{
+						"domain":   map[string]any{"name": userDomain},
+						"name":     k.User,
+						"password": k.Password,
+					},
+				},
+			},
+			"scope": keystoneScope(fs),
+		},
+	}
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return keystoneToken{}, fmt.Errorf("Error while encoding token request: %w", err)
+	}
+
+	url := strings.TrimSuffix(k.URL, "/") + "/v3/auth/tokens"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return keystoneToken{}, fmt.Errorf("Error while creating Request %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return keystoneToken{}, fmt.Errorf("Error while requesting token %w", err)
+	}
+	defer res.Body.Close()
+
+	resData, err := io.ReadAll(res.Body)
+	if err != nil {
+		return keystoneToken{}, fmt.Errorf("Error while reading response body %w", err)
+	}
+	if res.StatusCode != http.StatusCreated {
+		return keystoneToken{}, fmt.Errorf("Keystone answered with %d: %s", res.StatusCode, resData)
+	}
+
+	value := res.Header.Get("X-Subject-Token")
+	if value == "" {
+		return keystoneToken{}, errors.New("Keystone response without X-Subject-Token")
+	}
+	var respToken struct {
+		Token struct {
+			ExpiresAt time.Time `json:"expires_at"`
+		} `json:"token"`
+	}
+	// A missing or unparsable expiry only disables renewal before expiry,
+	// an expired token is still renewed once it is rejected.
+	json.Unmarshal(resData, &respToken)
+	return keystoneToken{value: value, expiresAt: respToken.Token.ExpiresAt}, nil
+}
@@ -0,0 +1,117 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestKeystoneTokenProvider(t *testing.T) {
+	var issued atomic.Int32
+	keystone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/auth/tokens" {
+			t.Errorf("Unexpected keystone path %s", r.URL.Path)
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		scope := body["auth"].(map[string]any)["scope"].(map[string]any)
+		if _, ok := scope["domain"]; !ok {
+			t.Errorf("Expected domain scope, got %v", scope)
+		}
+		n := issued.Add(1)
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":{"expires_at":%q}}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer keystone.Close()
+
+	// The agent accepts only the second token, so the first one has to be refreshed.
+	var calls atomic.Int32
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("X-Auth-Token") != "token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"count":0,"devices":[]}`))
+	}))
+	defer agent.Close()
+
+	iotaAuth := newTestIoTA(t, agent.URL,
+		i.WithTokenProvider(i.NewKeystoneTokenProvider(keystone.URL, "user", "password")),
+	)
+	_, err := iotaAuth.ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = iotaAuth.ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued.Load() != 2 {
+		t.Errorf("Expected 2 issued tokens, got %d", issued.Load())
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 calls to the agent, got %d", calls.Load())
+	}
+}
+
+func TestKeystoneTokenProviderConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	var issued atomic.Int32
+	keystone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		scope := body["auth"].(map[string]any)["scope"].(map[string]any)
+		domain := scope["domain"].(map[string]any)["name"]
+		if domain == "slow" {
+			<-release
+		}
+		n := issued.Add(1)
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("%s-%d", domain, n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":{"expires_at":%q}}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer keystone.Close()
+	defer close(release)
+
+	k := i.NewKeystoneTokenProvider(keystone.URL, "user", "password")
+	slow := i.FiwareService{Service: "slow", ServicePath: "/"}
+	fast := i.FiwareService{Service: "fast", ServicePath: "/"}
+
+	tokens := make(chan string, 3)
+	for range 3 {
+		go func() {
+			token, err := k.Token(context.Background(), slow)
+			if err != nil {
+				t.Error(err)
+			}
+			tokens <- token
+		}()
+	}
+
+	// A pending request for one service must not block the others
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := k.Token(ctx, fast); err != nil {
+		t.Fatalf("Token for other service blocked: %v", err)
+	}
+
+	release <- struct{}{}
+	first := <-tokens
+	for range 2 {
+		if token := <-tokens; token != first {
+			t.Errorf("Expected shared token %s, got %s", first, token)
+		}
+	}
+	if issued.Load() != 2 {
+		t.Errorf("Expected 2 issued tokens, got %d", issued.Load())
+	}
+}
@@ -0,0 +1,195 @@
+package iotagentsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the IoT Agent while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("Circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests pass.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all requests fast with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen probes the IoT Agent with a healthcheck to decide whether to close the circuit again.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker configures the circuit breaker of an IoTA.
+// The circuit opens after FailureThreshold consecutive failures, i.e. connection errors or 5xx responses.
+// After OpenTimeout the next request probes the agent with a healthcheck, on success the circuit
+// closes, otherwise it stays open for another OpenTimeout.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	// ProbeTimeout limits the healthcheck probing the agent while half-open, 5s if not set.
+	// The probe does not end with the context of the request triggering it.
+	ProbeTimeout time.Duration
+	// OnStateChange is called on every state change, if not nil.
+	OnStateChange func(from, to CircuitState)
+}
+
+// WithCircuitBreaker enables a circuit breaker for the IoT Agent.
+// The state of the circuit breaker is shared by all copies of the IoTA.
+func WithCircuitBreaker(cb CircuitBreaker) Option {
+	return func(i *IoTA) error {
+		if cb.FailureThreshold < 1 {
+			return errors.New("Failure threshold of circuit breaker must be at least 1")
+		}
+		i.breaker = &breaker{config: cb}
+		return nil
+	}
+}
+
+// defaultProbeTimeout is the ProbeTimeout used if none is set.
+const defaultProbeTimeout = 5 * time.Second
+
+// breaker holds the state of a circuit breaker.
+type breaker struct {
+	config CircuitBreaker
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+}
+
+// CircuitState returns the state of the circuit breaker, CircuitClosed if there is none.
+func (i IoTA) CircuitState() CircuitState {
+	if i.breaker == nil {
+		return CircuitClosed
+	}
+	i.breaker.mu.Lock()
+	defer i.breaker.mu.Unlock()
+	return i.breaker.state
+}
+
+// transition is a state change of the breaker.
+type transition struct {
+	from, to CircuitState
+}
+
+// setState changes the state of the breaker and returns the change, if any. b.mu must be held.
+// The change must be passed to notify after b.mu is released.
+func (b *breaker) setState(to CircuitState) []transition {
+	from := b.state
+	if from == to {
+		return nil
+	}
+	b.state = to
+	if to == CircuitOpen {
+		b.openedAt = time.Now()
+	}
+	if to == CircuitClosed {
+		b.failures = 0
+	}
+	return []transition{{from, to}}
+}
+
+// notify reports state changes to the logger, the metrics and the OnStateChange callback.
+// It must be called without holding the lock of the breaker.
+func (i IoTA) notify(ctx context.Context, transitions []transition) {
+	for _, t := range transitions {
+		i.log(ctx, slog.LevelWarn, "Circuit breaker state changed", "host", i.Host, "from", t.from, "to", t.to)
+		if i.metrics != nil {
+			i.metrics.circuitState.WithLabelValues(i.Host).Set(float64(t.to))
+		}
+		if i.breaker.config.OnStateChange != nil {
+			i.breaker.config.OnStateChange(t.from, t.to)
+		}
+	}
+}
+
+// allow reports if a request may be sent. If the circuit is open and the open timeout elapsed,
+// the IoT Agent is probed with a single healthcheck without retries.
+func (i IoTA) allow(ctx context.Context) error {
+	b := i.breaker
+	b.mu.Lock()
+	if b.state == CircuitClosed {
+		b.mu.Unlock()
+		return nil
+	}
+	if b.state == CircuitHalfOpen || time.Since(b.openedAt) < b.config.OpenTimeout {
+		b.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	transitions := b.setState(CircuitHalfOpen)
+	b.mu.Unlock()
+	i.notify(ctx, transitions)
+
+	timeout := b.config.ProbeTimeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	probeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	_, err := i.withoutRetries().HealthcheckCtx(probeCtx)
+	cancel()
+
+	b.mu.Lock()
+	if err != nil {
+		transitions = b.setState(CircuitOpen)
+	} else {
+		transitions = b.setState(CircuitClosed)
+	}
+	b.mu.Unlock()
+	i.notify(ctx, transitions)
+	if err != nil {
+		return fmt.Errorf("%w: healthcheck failed: %w", ErrCircuitOpen, err)
+	}
+	return nil
+}
+
+// record records the outcome of a request in the circuit breaker.
+func (i IoTA) record(ctx context.Context, call *Call, err error) {
+	failed := call.StatusCode >= http.StatusInternalServerError ||
+		(err != nil && call.StatusCode == 0 && ctx.Err() == nil)
+	b := i.breaker
+	b.mu.Lock()
+	var transitions []transition
+	if !failed {
+		b.failures = 0
+	} else {
+		b.failures++
+		if b.state == CircuitClosed && b.failures >= b.config.FailureThreshold {
+			transitions = b.setState(CircuitOpen)
+		}
+	}
+	b.mu.Unlock()
+	i.notify(ctx, transitions)
+}
+
+// circuitBreaking returns a Middleware failing fast while the circuit is open.
+func (i IoTA) circuitBreaking(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		err := i.allow(ctx)
+		if err != nil {
+			return err
+		}
+		err = next(ctx, call)
+		i.record(ctx, call, err)
+		return err
+	}
+}
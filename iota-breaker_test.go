@@ -0,0 +1,199 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var devices atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/iot/devices" {
+			devices.Add(1)
+		}
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"name":"INTERNAL_ERROR","message":"down"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Path == "/iot/about" {
+			w.Write([]byte(`{"libVersion":"4.0.0","port":"4041","baseRoot":"/","version":"4.0.0"}`))
+			return
+		}
+		w.Write([]byte(`{"count":0,"devices":[]}`))
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var changes []string
+	iotaCB := newTestIoTA(t, srv.URL,
+		i.WithRetryPolicy(i.RetryPolicy{}),
+		i.WithCircuitBreaker(i.CircuitBreaker{
+			FailureThreshold: 2,
+			OpenTimeout:      20 * time.Millisecond,
+			OnStateChange: func(from, to i.CircuitState) {
+				mu.Lock()
+				defer mu.Unlock()
+				changes = append(changes, from.String()+"->"+to.String())
+			},
+		}),
+	)
+
+	for n := 0; n < 2; n++ {
+		_, err := iotaCB.ListDevices(fs)
+		if err == nil || errors.Is(err, i.ErrCircuitOpen) {
+			t.Fatalf("Expected error from agent, got %v", err)
+		}
+	}
+	if iotaCB.CircuitState() != i.CircuitOpen {
+		t.Fatalf("Expected open circuit, got %s", iotaCB.CircuitState())
+	}
+
+	_, err := iotaCB.ListDevices(fs)
+	if !errors.Is(err, i.ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if devices.Load() != 2 {
+		t.Errorf("Expected 2 requests to reach the agent, got %d", devices.Load())
+	}
+
+	// Probe fails, circuit stays open
+	time.Sleep(30 * time.Millisecond)
+	_, err = iotaCB.ListDevices(fs)
+	if !errors.Is(err, i.ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen after failed probe, got %v", err)
+	}
+
+	// Probe succeeds, circuit closes
+	healthy.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	_, err = iotaCB.ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iotaCB.CircuitState() != i.CircuitClosed {
+		t.Fatalf("Expected closed circuit, got %s", iotaCB.CircuitState())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"closed->open",
+		"open->half-open", "half-open->open",
+		"open->half-open", "half-open->closed",
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected state changes %v, got %v", expected, changes)
+	}
+	for idx := range expected {
+		if changes[idx] != expected[idx] {
+			t.Errorf("Expected state changes %v, got %v", expected, changes)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerClientErrors(t *testing.T) {
+	srv, _ := newFlakyServer(t, 0, http.StatusNotFound, `{"name":"DEVICE_NOT_FOUND","message":"not found"}`)
+	iotaCB := newTestIoTA(t, srv.URL,
+		i.WithCircuitBreaker(i.CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Minute}),
+	)
+	for n := 0; n < 3; n++ {
+		_, err := iotaCB.ReadDevice(fs, deviceId)
+		if !errors.Is(err, i.ErrDeviceNotFound) {
+			t.Fatalf("Expected ErrDeviceNotFound, got %v", err)
+		}
+	}
+	if iotaCB.CircuitState() != i.CircuitClosed {
+		t.Errorf("Expected closed circuit, got %s", iotaCB.CircuitState())
+	}
+}
+
+func TestCircuitBreakerCallbackReentrant(t *testing.T) {
+	srv, _ := newFlakyServer(t, 0, http.StatusInternalServerError, `{"name":"INTERNAL_ERROR","message":"down"}`)
+	var iotaCB *i.IoTA
+	var states []i.CircuitState
+	iotaCB = newTestIoTA(t, srv.URL,
+		i.WithRetryPolicy(i.RetryPolicy{}),
+		i.WithCircuitBreaker(i.CircuitBreaker{
+			FailureThreshold: 1,
+			OpenTimeout:      time.Minute,
+			OnStateChange: func(from, to i.CircuitState) {
+				states = append(states, iotaCB.CircuitState())
+				iotaCB.ListDevices(fs)
+			},
+		}),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		iotaCB.ListDevices(fs)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Deadlock in state change callback")
+	}
+	if len(states) != 1 || states[0] != i.CircuitOpen {
+		t.Errorf("Expected callback to see the open circuit, got %v", states)
+	}
+}
+
+func TestCircuitBreakerProbeNotRetried(t *testing.T) {
+	var probes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/iot/about" {
+			probes.Add(1)
+		}
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"name":"SERVICE_UNAVAILABLE","message":"down"}`))
+	}))
+	defer srv.Close()
+	p := fastRetryPolicy()
+	iotaCB := newTestIoTA(t, srv.URL,
+		i.WithRetryPolicy(p),
+		i.WithCircuitBreaker(i.CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Millisecond}),
+	)
+	iotaCB.ListDevices(fs)
+	time.Sleep(5 * time.Millisecond)
+	_, err := iotaCB.ListDevices(fs)
+	if !errors.Is(err, i.ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if probes.Load() != 1 {
+		t.Errorf("Expected 1 probe request, got %d", probes.Load())
+	}
+}
+
+func TestCircuitBreakerProbeIgnoresCallerContext(t *testing.T) {
+	srv, _ := newFlakyServer(t, 1, http.StatusOK, `{"libVersion":"4.3.0","port":"4061","baseRoot":"/","version":"1.0.0"}`)
+	iotaCB := newTestIoTA(t, srv.URL,
+		i.WithRetryPolicy(i.RetryPolicy{}),
+		i.WithCircuitBreaker(i.CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Millisecond}),
+	)
+	iotaCB.ListDevices(fs)
+	if iotaCB.CircuitState() != i.CircuitOpen {
+		t.Fatalf("Expected open circuit, got %s", iotaCB.CircuitState())
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// The canceled context of the caller must not fail the probe of a healthy agent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	iotaCB.ListDevicesCtx(ctx, fs)
+	if iotaCB.CircuitState() != i.CircuitClosed {
+		t.Errorf("Expected closed circuit after probe, got %s", iotaCB.CircuitState())
+	}
+}
@@ -1,21 +1,21 @@
 package iotagentsdk
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"iter"
+	"log/slog"
 	"net/http"
-	"strings"
+	u "net/url"
 
 	"github.com/niemeyer/golang/src/pkg/container/vector"
-	"github.com/rs/zerolog/log"
 )
 
 // Constants
 const (
-	urlService = urlBase + "/iot/services"
+	urlService = "/iot/services"
 )
 
 // Error handling
@@ -33,117 +33,126 @@ func (sg ConfigGroup) Validate() error {
 		mF.Fields.Push("Resource")
 	}
 
-	if mF.Fields.Len() == 0 {
-		return nil
-	} else {
+	if mF.Fields.Len() != 0 {
 		return mF
 	}
+	return validateNgsiLD(sg.NgsiVersion, sg.JsonLdContext, attributeNames(sg.Attributes, sg.Lazy, sg.StaticAttributes, sg.Commands), sg.StaticAttributes)
 }
 
 // Response struct for reading ConfigGroup
 type RespReadConfigGroup struct {
+	// Count is the total number of config groups, not only of this page.
 	Count    int           `json:"count"`
 	Services []ConfigGroup `json:"services"`
+	// Correlator is the fiware-correlator of the response.
+	Correlator string `json:"-"`
 }
 
+func (r *RespReadConfigGroup) setCorrelator(correlator string) { r.Correlator = correlator }
+
 // Request struct for creating ConfigGroup
 type ReqCreateConfigGroup struct {
 	Services []ConfigGroup `json:"services"`
 }
 
+// configGroupURL returns the url of the config group identified by r and a.
+func (i IoTA) configGroupURL(r Resource, a Apikey) string {
+	query := u.Values{}
+	query.Set("resource", string(r))
+	query.Set("apikey", string(a))
+	return i.url(urlService) + "?" + query.Encode()
+}
+
 // Method to read a ConfigGroup
 func (i IoTA) ReadConfigGroup(fs FiwareService, r Resource, a Apikey) (*RespReadConfigGroup, error) {
-	url := urlService + fmt.Sprintf("?resource=%s&apikey=%s", r, a)
-
-	method := "GET"
-
-	client := i.Client()
-	req, err := http.NewRequest(method, fmt.Sprintf(url, i.Host, i.Port), nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		err = json.Unmarshal(resData, &apiError)
-		if err != nil {
-			return nil, fmt.Errorf("Unexpected Error, is host %s a IoT-Agent?", i.Host)
-		}
-
-		return nil, apiError
-	}
+	return i.ReadConfigGroupCtx(context.Background(), fs, r, a)
+}
 
-	responseData, err := io.ReadAll(res.Body)
+// ReadConfigGroupCtx is like ReadConfigGroup but uses the given context for the request.
+func (i IoTA) ReadConfigGroupCtx(ctx context.Context, fs FiwareService, r Resource, a Apikey) (*RespReadConfigGroup, error) {
+	var respReadConfigGroup RespReadConfigGroup
+	err := i.do(ctx, request{
+		op:       "ReadConfigGroup",
+		method:   http.MethodGet,
+		url:      i.configGroupURL(r, a),
+		fs:       fs,
+		resource: r,
+		apikey:   a,
+		status:   http.StatusOK,
+		out:      &respReadConfigGroup,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
+		return nil, err
 	}
-
-	var respReadConfigGroup RespReadConfigGroup
-	json.Unmarshal(responseData, &respReadConfigGroup)
 	return &respReadConfigGroup, nil
 }
 
 // Method to list ConfigGroups
 func (i IoTA) ListConfigGroups(fs FiwareService) (*RespReadConfigGroup, error) {
-	url := urlService
+	return i.ListConfigGroupsCtx(context.Background(), fs)
+}
 
-	method := "GET"
+// ListConfigGroupsCtx is like ListConfigGroups but uses the given context for the request.
+func (i IoTA) ListConfigGroupsCtx(ctx context.Context, fs FiwareService) (*RespReadConfigGroup, error) {
+	return i.ListConfigGroupsWithOptionsCtx(ctx, fs, ListOptions{})
+}
 
-	client := i.Client()
-	req, err := http.NewRequest(method, fmt.Sprintf(url, i.Host, i.Port), nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+// ListConfigGroupsWithOptions lists a page of ConfigGroups.
+func (i IoTA) ListConfigGroupsWithOptions(fs FiwareService, opts ListOptions) (*RespReadConfigGroup, error) {
+	return i.ListConfigGroupsWithOptionsCtx(context.Background(), fs, opts)
+}
 
-	res, err := client.Do(req)
+// ListConfigGroupsWithOptionsCtx is like ListConfigGroupsWithOptions but uses the given context for the request.
+func (i IoTA) ListConfigGroupsWithOptionsCtx(ctx context.Context, fs FiwareService, opts ListOptions) (*RespReadConfigGroup, error) {
+	var respReadConfigGroup RespReadConfigGroup
+	err := i.do(ctx, request{
+		op:     "ListConfigGroups",
+		method: http.MethodGet,
+		url:    withQuery(i.url(urlService), opts.query()),
+		fs:     fs,
+		status: http.StatusOK,
+		out:    &respReadConfigGroup,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
+		return nil, err
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		err = json.Unmarshal(resData, &apiError)
-		if err != nil {
-			return nil, fmt.Errorf("Unexpected Error, is host %s a IoT-Agent?", i.Host)
-		}
+	return &respReadConfigGroup, nil
+}
 
-		return nil, apiError
+// AllConfigGroups returns an iterator over all ConfigGroups, requesting pages of opts.Limit
+// groups starting at opts.Offset. Iteration stops after the first error.
+func (i IoTA) AllConfigGroups(ctx context.Context, fs FiwareService, opts ListOptions) iter.Seq2[ConfigGroup, error] {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultPageSize
 	}
-
-	responseData, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
+	return func(yield func(ConfigGroup, error) bool) {
+		for {
+			page, err := i.ListConfigGroupsWithOptionsCtx(ctx, fs, opts)
+			if err != nil {
+				yield(ConfigGroup{}, err)
+				return
+			}
+			for _, cg := range page.Services {
+				if !yield(cg, nil) {
+					return
+				}
+			}
+			opts.Offset += len(page.Services)
+			if len(page.Services) == 0 || opts.Offset >= page.Count {
+				return
+			}
+		}
 	}
-
-	var respReadConfigGroup RespReadConfigGroup
-	json.Unmarshal(responseData, &respReadConfigGroup)
-	return &respReadConfigGroup, nil
 }
 
 // Method to check if a ConfigGroup exists
 func (i IoTA) ConfigGroupExists(fs FiwareService, r Resource, a Apikey) bool {
-	tmp, err := i.ReadConfigGroup(fs, r, a)
+	return i.ConfigGroupExistsCtx(context.Background(), fs, r, a)
+}
+
+// ConfigGroupExistsCtx is like ConfigGroupExists but uses the given context for the request.
+func (i IoTA) ConfigGroupExistsCtx(ctx context.Context, fs FiwareService, r Resource, a Apikey) bool {
+	tmp, err := i.ReadConfigGroupCtx(ctx, fs, r, a)
 	if err != nil {
 		return false
 	}
@@ -152,12 +161,22 @@ func (i IoTA) ConfigGroupExists(fs FiwareService, r Resource, a Apikey) bool {
 
 // Method to create a ConfigGroup
 func (i IoTA) CreateConfigGroup(fs FiwareService, sg ConfigGroup) error {
+	return i.CreateConfigGroupCtx(context.Background(), fs, sg)
+}
+
+// CreateConfigGroupCtx is like CreateConfigGroup but uses the given context for the request.
+func (i IoTA) CreateConfigGroupCtx(ctx context.Context, fs FiwareService, sg ConfigGroup) error {
 	sgs := [1]ConfigGroup{sg}
-	return i.CreateConfigGroups(fs, sgs[:])
+	return i.CreateConfigGroupsCtx(ctx, fs, sgs[:])
 }
 
 // Method to create multiple ConfigGroups
 func (i IoTA) CreateConfigGroups(fs FiwareService, sgs []ConfigGroup) error {
+	return i.CreateConfigGroupsCtx(context.Background(), fs, sgs)
+}
+
+// CreateConfigGroupsCtx is like CreateConfigGroups but uses the given context for the request.
+func (i IoTA) CreateConfigGroupsCtx(ctx context.Context, fs FiwareService, sgs []ConfigGroup) error {
 	for _, sg := range sgs {
 		err := sg.Validate()
 		if err != nil {
@@ -166,142 +185,100 @@ func (i IoTA) CreateConfigGroups(fs FiwareService, sgs []ConfigGroup) error {
 	}
 	reqCreateConfigGroup := ReqCreateConfigGroup{}
 	reqCreateConfigGroup.Services = sgs[:]
-	method := "POST"
 
 	payload, err := json.Marshal(reqCreateConfigGroup)
 	if err != nil {
-		log.Panic().Err(err).Msg("Could not Marshal struct")
+		return fmt.Errorf("Error while encoding config groups: %w", err)
 	}
-	client := i.Client()
-	req, err := http.NewRequest(method, fmt.Sprintf(urlService, i.Host, i.Port), bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("Error while creating Request %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error while requesting resource %w", err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusCreated {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		err = json.Unmarshal(resData, &apiError)
-		if err != nil {
-			return fmt.Errorf("Unexpected Error, is host %s a IoT-Agent?", i.Host)
-		}
-
-		return apiError
+	var r Resource
+	var a Apikey
+	if len(sgs) == 1 {
+		r, a = sgs[0].Resource, sgs[0].Apikey
 	}
 
-	return nil
+	err = i.do(ctx, request{
+		op:        "CreateConfigGroups",
+		method:    http.MethodPost,
+		url:       i.url(urlService),
+		fs:        fs,
+		resource:  r,
+		apikey:    a,
+		payload:   payload,
+		status:    http.StatusCreated,
+		duplicate: ErrDuplicateGroup,
+	})
+	return err
 }
 
 // Method to update a ConfigGroup
 func (i IoTA) UpdateConfigGroup(fs FiwareService, r Resource, a Apikey, sg ConfigGroup) error {
+	return i.UpdateConfigGroupCtx(context.Background(), fs, r, a, sg)
+}
+
+// UpdateConfigGroupCtx is like UpdateConfigGroup but uses the given context for the request.
+func (i IoTA) UpdateConfigGroupCtx(ctx context.Context, fs FiwareService, r Resource, a Apikey, sg ConfigGroup) error {
 	err := sg.Validate()
 	if err != nil {
 		return err
 	}
-	url := urlService + fmt.Sprintf("?resource=%s&apikey=%s", r, a)
-	method := "PUT"
 
 	payload, err := json.Marshal(sg)
 	if err != nil {
-		log.Panic().Err(err).Msg("Could not Marshal struct")
+		return fmt.Errorf("Error while encoding config group: %w", err)
 	}
 	if string(payload) == "{}" {
 		return nil
 	}
-	client := i.Client()
-	req, err := http.NewRequest(method, fmt.Sprintf(url, i.Host, i.Port), bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("Error while creating Request %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error while requesting resource %w", err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusNoContent {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		err = json.Unmarshal(resData, &apiError)
-		if err != nil {
-			return fmt.Errorf("Unexpected Error, is host %s a IoT-Agent?", i.Host)
-		}
-
-		return apiError
-	}
 
-	return nil
+	err = i.do(ctx, request{
+		op:       "UpdateConfigGroup",
+		method:   http.MethodPut,
+		url:      i.configGroupURL(r, a),
+		fs:       fs,
+		resource: r,
+		apikey:   a,
+		payload:  payload,
+		status:   http.StatusNoContent,
+	})
+	return err
 }
 
 // Method to delete a ConfigGroup
 func (i IoTA) DeleteConfigGroup(fs FiwareService, r Resource, a Apikey) error {
-	url := urlService + fmt.Sprintf("?resource=%s&apikey=%s", r, a)
-
-	method := http.MethodDelete
-
-	client := http.Client{}
-	req, err := http.NewRequest(method, fmt.Sprintf(url, i.Host, i.Port), strings.NewReader(""))
-	if err != nil {
-		return fmt.Errorf("Error while creating Request %w", err)
-	}
-
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-
-	res, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error while requesting resource %w", err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusNoContent {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		err = json.Unmarshal(resData, &apiError)
-		if err != nil {
-			return fmt.Errorf("Unexpected Error, is host %s a IoT-Agent?", i.Host)
-		}
-
-		return apiError
-	}
+	return i.DeleteConfigGroupCtx(context.Background(), fs, r, a)
+}
 
-	return nil
+// DeleteConfigGroupCtx is like DeleteConfigGroup but uses the given context for the request.
+func (i IoTA) DeleteConfigGroupCtx(ctx context.Context, fs FiwareService, r Resource, a Apikey) error {
+	err := i.do(ctx, request{
+		op:       "DeleteConfigGroup",
+		method:   http.MethodDelete,
+		url:      i.configGroupURL(r, a),
+		fs:       fs,
+		resource: r,
+		apikey:   a,
+		status:   http.StatusNoContent,
+	})
+	return err
 }
 
 // Method to upsert a ConfigGroup
 func (i IoTA) UpsertConfigGroup(fs FiwareService, sg ConfigGroup) error {
-	exists := i.ConfigGroupExists(fs, sg.Resource, sg.Apikey)
+	return i.UpsertConfigGroupCtx(context.Background(), fs, sg)
+}
+
+// UpsertConfigGroupCtx is like UpsertConfigGroup but uses the given context for all requests.
+func (i IoTA) UpsertConfigGroupCtx(ctx context.Context, fs FiwareService, sg ConfigGroup) error {
+	exists := i.ConfigGroupExistsCtx(ctx, fs, sg.Resource, sg.Apikey)
 	if !exists {
-		log.Debug().Msg("Creating service group...")
-		err := i.CreateConfigGroup(fs, sg)
+		i.log(ctx, slog.LevelDebug, "Creating service group...", "service", fs.Service, "servicePath", fs.ServicePath)
+		err := i.CreateConfigGroupCtx(ctx, fs, sg)
 		if err != nil {
 			return err
 		}
 	} else {
-		log.Debug().Msg("Update service group...")
-		err := i.UpdateConfigGroup(fs, sg.Resource, sg.Apikey, sg)
+		i.log(ctx, slog.LevelDebug, "Update service group...", "service", fs.Service, "servicePath", fs.ServicePath)
+		err := i.UpdateConfigGroupCtx(ctx, fs, sg.Resource, sg.Apikey, sg)
 		if err != nil {
 			return err
 		}
@@ -311,16 +288,21 @@ func (i IoTA) UpsertConfigGroup(fs FiwareService, sg ConfigGroup) error {
 
 // Method to create a ConfigGroup, getting the created ConfigGroup and setting it.
 func (i IoTA) CreateConfigGroupWSE(fs FiwareService, sg *ConfigGroup) error {
+	return i.CreateConfigGroupWSECtx(context.Background(), fs, sg)
+}
+
+// CreateConfigGroupWSECtx is like CreateConfigGroupWSE but uses the given context for all requests.
+func (i IoTA) CreateConfigGroupWSECtx(ctx context.Context, fs FiwareService, sg *ConfigGroup) error {
 	if sg == nil {
 		return errors.New("Service group reference cannot be nil")
 	}
 
-	err := i.CreateConfigGroup(fs, *sg)
+	err := i.CreateConfigGroupCtx(ctx, fs, *sg)
 	if err != nil {
 		return err
 	}
 
-	sgTmp, err := i.ReadConfigGroup(fs, sg.Resource, sg.Apikey)
+	sgTmp, err := i.ReadConfigGroupCtx(ctx, fs, sg.Resource, sg.Apikey)
 	if err != nil {
 		return err
 	}
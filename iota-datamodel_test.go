@@ -0,0 +1,126 @@
+package iotagentsdk_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+// device.json and config-group.json were recorded from an IoT Agent with iotagent-node-lib 4.3.0.
+// The -extra files cover fields the agent only returns in other setups, such as NGSI-LD
+// or stored measures.
+var (
+	deviceFixtures      = []string{"device.json", "device-extra.json"}
+	configGroupFixtures = []string{"config-group.json", "config-group-extra.json"}
+)
+
+// readFixture returns the fixture as is and decoded into a generic map.
+func readFixture(t *testing.T, name string) ([]byte, map[string]any) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generic map[string]any
+	err = json.Unmarshal(data, &generic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, generic
+}
+
+// assertRoundTrip checks that encoded holds the same JSON as expected.
+func assertRoundTrip(t *testing.T, expected map[string]any, encoded []byte) {
+	t.Helper()
+	var got map[string]any
+	err := json.Unmarshal(encoded, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := range expected {
+		if !reflect.DeepEqual(expected[key], got[key]) {
+			t.Errorf("Field %s: expected %v, got %v", key, expected[key], got[key])
+		}
+	}
+	for key := range got {
+		if _, ok := expected[key]; !ok {
+			t.Errorf("Unexpected field %s: %v", key, got[key])
+		}
+	}
+}
+
+// assertFieldsCovered checks that every JSON field of typ appears in one of the fixtures.
+func assertFieldsCovered(t *testing.T, typ reflect.Type, fixtures []map[string]any) {
+	t.Helper()
+	for idx := 0; idx < typ.NumField(); idx++ {
+		name, _, _ := strings.Cut(typ.Field(idx).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		covered := false
+		for _, fixture := range fixtures {
+			_, ok := fixture[name]
+			covered = covered || ok
+		}
+		if !covered {
+			t.Errorf("Field %s of %s is not covered by a fixture", name, typ.Name())
+		}
+	}
+}
+
+func TestDeviceRoundTrip(t *testing.T) {
+	var fixtures []map[string]any
+	for _, name := range deviceFixtures {
+		t.Run(name, func(t *testing.T) {
+			data, expected := readFixture(t, name)
+			fixtures = append(fixtures, expected)
+			var device i.Device
+			err := json.Unmarshal(data, &device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := json.Marshal(&device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertRoundTrip(t, expected, encoded)
+		})
+	}
+	assertFieldsCovered(t, reflect.TypeOf(i.Device{}), fixtures)
+}
+
+func TestConfigGroupRoundTrip(t *testing.T) {
+	var fixtures []map[string]any
+	for _, name := range configGroupFixtures {
+		t.Run(name, func(t *testing.T) {
+			data, expected := readFixture(t, name)
+			fixtures = append(fixtures, expected)
+			var cg i.ConfigGroup
+			err := json.Unmarshal(data, &cg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := json.Marshal(cg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertRoundTrip(t, expected, encoded)
+		})
+	}
+	assertFieldsCovered(t, reflect.TypeOf(i.ConfigGroup{}), fixtures)
+}
+
+func TestDeviceTimezone(t *testing.T) {
+	encoded, err := json.Marshal(&i.Device{Id: deviceId, Timezone: "Europe/Berlin", ExplicitAttrs: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"timezone":"Europe/Berlin"`) {
+		t.Errorf("Expected timezone in %s", encoded)
+	}
+}
@@ -0,0 +1,172 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+// garbageResponses are responses an IoT Agent never sends, but proxies or broken connections may.
+var garbageResponses = []struct {
+	name        string
+	status      int
+	contentType string
+	body        string
+}{
+	{"html error page", http.StatusBadGateway, "text/html", "<html><body><h1>502 Bad Gateway</h1></body></html>"},
+	{"html success page", http.StatusOK, "text/html", "<html><body>It works!</body></html>"},
+	{"truncated json", http.StatusOK, "application/json", `{"count":1,"devices":[{"device_id":"te`},
+	{"wrong types", http.StatusOK, "application/json", `{"count":"one","services":{},"devices":1,"libVersion":4,"device_id":1,"sum":1,"level":1}`},
+	{"empty body", http.StatusNotFound, "", ""},
+	{"json without error name", http.StatusInternalServerError, "application/json", `{"error":"Internal"}`},
+	{"huge plain text", http.StatusServiceUnavailable, "text/plain", strings.Repeat("x", 10000)},
+}
+
+// operations calls every method of IoTA sending a request.
+var operations = map[string]func(iota *i.IoTA) error{
+	"Healthcheck":  func(iota *i.IoTA) error { _, err := iota.Healthcheck(); return err },
+	"ReadDevice":   func(iota *i.IoTA) error { _, err := iota.ReadDevice(fs, deviceId); return err },
+	"ListDevices":  func(iota *i.IoTA) error { _, err := iota.ListDevices(fs); return err },
+	"CreateDevice": func(iota *i.IoTA) error { return iota.CreateDevice(fs, d) },
+	"UpdateDevice": func(iota *i.IoTA) error {
+		dtmp := d
+		dtmp.EntityName = updatedEntityName
+		return iota.UpdateDevice(fs, dtmp)
+	},
+	"DeleteDevice":    func(iota *i.IoTA) error { return iota.DeleteDevice(fs, deviceId) },
+	"UpsertDevice":    func(iota *i.IoTA) error { return iota.UpsertDevice(fs, d) },
+	"CreateDeviceWSE": func(iota *i.IoTA) error { dtmp := d; return iota.CreateDeviceWSE(fs, &dtmp) },
+	"ReadConfigGroup": func(iota *i.IoTA) error { _, err := iota.ReadConfigGroup(fs, resource, apiKey); return err },
+	"ListConfigGroups": func(iota *i.IoTA) error {
+		_, err := iota.ListConfigGroups(fs)
+		return err
+	},
+	"CreateConfigGroup": func(iota *i.IoTA) error { return iota.CreateConfigGroup(fs, sg) },
+	"UpdateConfigGroup": func(iota *i.IoTA) error {
+		return iota.UpdateConfigGroup(fs, resource, apiKey, sg)
+	},
+	"DeleteConfigGroup":    func(iota *i.IoTA) error { return iota.DeleteConfigGroup(fs, resource, apiKey) },
+	"UpsertConfigGroup":    func(iota *i.IoTA) error { return iota.UpsertConfigGroup(fs, sg) },
+	"CreateConfigGroupWSE": func(iota *i.IoTA) error { sgtmp := sg; return iota.CreateConfigGroupWSE(fs, &sgtmp) },
+	"GetAllServicePathsForService": func(iota *i.IoTA) error {
+		_, err := iota.GetAllServicePathsForService(service)
+		return err
+	},
+	"Metrics":          func(iota *i.IoTA) error { _, err := iota.Metrics(); return err },
+	"MetricsText":      func(iota *i.IoTA) error { _, err := iota.MetricsText(); return err },
+	"GetAgentLogLevel": func(iota *i.IoTA) error { _, err := iota.GetAgentLogLevel(); return err },
+	"SetAgentLogLevel": func(iota *i.IoTA) error { return iota.SetAgentLogLevel(i.AgentLogLevelDebug) },
+	"Do": func(iota *i.IoTA) error {
+		var out i.RespHealthcheck
+		return iota.Do(context.Background(), http.MethodGet, "/iot/about", fs, nil, &out)
+	},
+	"DoWithoutResult": func(iota *i.IoTA) error {
+		return iota.Do(context.Background(), http.MethodPost, "/iot/about", fs, nil, nil)
+	},
+}
+
+// managerOperations calls every method of IoTAManager sending a request.
+var managerOperations = map[string]func(m *i.IoTAManager) error{
+	"RegisterProtocol": func(m *i.IoTAManager) error {
+		return m.RegisterProtocol(i.Protocol{Protocol: "IoTA-UL", IoTAgent: "http://iot-agent:4061", Resource: resource})
+	},
+	"ListProtocols":  func(m *i.IoTAManager) error { _, err := m.ListProtocols(i.ListOptions{}); return err },
+	"DeleteProtocol": func(m *i.IoTAManager) error { return m.DeleteProtocol("IoTA-UL") },
+	"ReadConfigGroup": func(m *i.IoTAManager) error {
+		_, err := m.ReadConfigGroup(fs, "IoTA-UL", resource, apiKey)
+		return err
+	},
+	"ListConfigGroups": func(m *i.IoTAManager) error {
+		_, err := m.ListConfigGroups(fs, "IoTA-UL")
+		return err
+	},
+	"CreateConfigGroup": func(m *i.IoTAManager) error { return m.CreateConfigGroup(fs, "IoTA-UL", sg) },
+	"UpdateConfigGroup": func(m *i.IoTAManager) error {
+		return m.UpdateConfigGroup(fs, "IoTA-UL", resource, apiKey, sg)
+	},
+	"DeleteConfigGroup": func(m *i.IoTAManager) error { return m.DeleteConfigGroup(fs, "IoTA-UL", resource, apiKey) },
+}
+
+// withoutResult are the operations without a result which accept any success status,
+// so a garbage response is only detected if its status reports a failure.
+var withoutResult = map[string]bool{
+	"SetAgentLogLevel":         true,
+	"DoWithoutResult":          true,
+	"ManagerRegisterProtocol":  true,
+	"ManagerDeleteProtocol":    true,
+	"ManagerCreateConfigGroup": true,
+	"ManagerUpdateConfigGroup": true,
+	"ManagerDeleteConfigGroup": true,
+}
+
+// assertDecodeError checks that err is a DecodeError describing resp.
+func assertDecodeError(t *testing.T, err error, status int, contentType, body string) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	var decodeErr *i.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected DecodeError, got %T: %v", err, err)
+	}
+	if decodeErr.StatusCode != status || decodeErr.ContentType != contentType {
+		t.Errorf("Unexpected DecodeError %v", decodeErr)
+	}
+	if decodeErr.Correlator != "garbage-correlator" {
+		t.Errorf("Expected correlator on DecodeError, got %q", decodeErr.Correlator)
+	}
+	if len(decodeErr.Snippet) > 512 || !strings.HasPrefix(body, decodeErr.Snippet) {
+		t.Errorf("Unexpected snippet %q", decodeErr.Snippet)
+	}
+}
+
+func TestGarbageResponses(t *testing.T) {
+	for _, resp := range garbageResponses {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("fiware-correlator", "garbage-correlator")
+			if resp.contentType != "" {
+				w.Header().Set("Content-Type", resp.contentType)
+			}
+			w.WriteHeader(resp.status)
+			w.Write([]byte(resp.body))
+		}))
+		iotaGarbage := newTestIoTA(t, srv.URL, i.WithRetryPolicy(i.RetryPolicy{}))
+
+		manager, err := i.NewIoTAManager("", 0, i.WithBaseURL(srv.URL), i.WithRetryPolicy(i.RetryPolicy{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		success := resp.status >= 200 && resp.status < 300
+
+		for name, op := range operations {
+			t.Run(resp.name+"/"+name, func(t *testing.T) {
+				err := op(iotaGarbage)
+				if success && withoutResult[name] {
+					if err != nil {
+						t.Errorf("Expected success without result, got %v", err)
+					}
+					return
+				}
+				assertDecodeError(t, err, resp.status, resp.contentType, resp.body)
+			})
+		}
+		for name, op := range managerOperations {
+			t.Run(resp.name+"/Manager"+name, func(t *testing.T) {
+				err := op(manager)
+				if success && withoutResult["Manager"+name] {
+					if err != nil {
+						t.Errorf("Expected success without result, got %v", err)
+					}
+					return
+				}
+				assertDecodeError(t, err, resp.status, resp.contentType, resp.body)
+			})
+		}
+		srv.Close()
+	}
+}
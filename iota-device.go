@@ -1,21 +1,22 @@
 package iotagentsdk
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"iter"
+	"log/slog"
+	"maps"
 	"net/http"
 	u "net/url"
 
 	"github.com/niemeyer/golang/src/pkg/container/vector"
-	log "github.com/rs/zerolog/log"
 )
 
 // Constants
 const (
-	urlDevice = urlBase + "/iot/devices"
+	urlDevice = "/iot/devices"
 )
 
 // Request struct for creating a device
@@ -23,12 +24,17 @@ type reqCreateDevice struct {
 	Devices []Device `json:"devices"`
 }
 
-// Response struct for listing devices
-type respListDevices struct {
+// RespListDevices is a page of devices.
+type RespListDevices struct {
+	// Count is the total number of devices, not only of this page.
 	Count   int      `json:"count"`
 	Devices []Device `json:"devices"`
+	// Correlator is the fiware-correlator of the response.
+	Correlator string `json:"-"`
 }
 
+func (r *RespListDevices) setCorrelator(correlator string) { r.Correlator = correlator }
+
 // Function to validate a Device
 func (d Device) Validate() error {
 	mF := &MissingFields{make(vector.StringVector, 0), "Missing fields"}
@@ -36,64 +42,46 @@ func (d Device) Validate() error {
 		mF.Fields.Push("Id")
 	}
 
-	if mF.Fields.Len() == 0 {
-		return nil
-	} else {
+	if mF.Fields.Len() != 0 {
 		return mF
 	}
+	if d.NgsiVersion.IsLD() && d.EntityName != "" && !isURI(d.EntityName) {
+		return fmt.Errorf("%w: entity name %q is not a URI, see NgsiLDEntityId", ErrInvalidNgsiLD, d.EntityName)
+	}
+	return validateNgsiLD(d.NgsiVersion, d.JsonLdContext, attributeNames(d.Attributes, d.Lazy, d.StaticAttributes, d.Commands), d.StaticAttributes)
 }
 
 // Method to read a device
 func (i IoTA) ReadDevice(fs FiwareService, id DeciveId) (*Device, error) {
-	url, err := u.JoinPath(fmt.Sprintf(urlDevice, i.Host, i.Port), u.PathEscape(string(id)))
-	if err != nil {
-		return nil, err
-	}
-	method := "GET"
-
-	client := i.Client()
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		err = json.Unmarshal(resData, &apiError)
-		if err != nil {
-			log.Panic().Err(err).Msg("Could not Marshal struct")
-		}
-		return nil, apiError
-	}
-
-	responseData, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
-	}
+	return i.ReadDeviceCtx(context.Background(), fs, id)
+}
 
+// ReadDeviceCtx is like ReadDevice but uses the given context for the request.
+func (i IoTA) ReadDeviceCtx(ctx context.Context, fs FiwareService, id DeciveId) (*Device, error) {
 	var device Device
-	json.Unmarshal(responseData, &device)
+	err := i.do(ctx, request{
+		op:     "ReadDevice",
+		method: http.MethodGet,
+		url:    i.url(urlDevice, u.PathEscape(string(id))),
+		fs:     fs,
+		id:     id,
+		status: http.StatusOK,
+		out:    &device,
+	})
 	if err != nil {
-		log.Panic().Err(err).Msg("Could not Marshal struct")
+		return nil, err
 	}
 	return &device, nil
 }
 
 // Method to check if a device exists
 func (i IoTA) DeviceExists(fs FiwareService, id DeciveId) bool {
-	_, err := i.ReadDevice(fs, id)
+	return i.DeviceExistsCtx(context.Background(), fs, id)
+}
+
+// DeviceExistsCtx is like DeviceExists but uses the given context for the request.
+func (i IoTA) DeviceExistsCtx(ctx context.Context, fs FiwareService, id DeciveId) bool {
+	_, err := i.ReadDeviceCtx(ctx, fs, id)
 	if err != nil {
 		return false
 	}
@@ -101,50 +89,70 @@ func (i IoTA) DeviceExists(fs FiwareService, id DeciveId) bool {
 }
 
 // Method to list devices
-func (i IoTA) ListDevices(fs FiwareService) (*respListDevices, error) {
-	url := fmt.Sprintf(urlDevice, i.Host, i.Port)
+func (i IoTA) ListDevices(fs FiwareService) (*RespListDevices, error) {
+	return i.ListDevicesCtx(context.Background(), fs)
+}
 
-	method := "GET"
+// ListDevicesCtx is like ListDevices but uses the given context for the request.
+func (i IoTA) ListDevicesCtx(ctx context.Context, fs FiwareService) (*RespListDevices, error) {
+	return i.ListDevicesWithOptionsCtx(ctx, fs, ListOptions{})
+}
 
-	client := i.Client()
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
+// ListDevicesWithOptions lists a page of devices.
+func (i IoTA) ListDevicesWithOptions(fs FiwareService, opts ListOptions) (*RespListDevices, error) {
+	return i.ListDevicesWithOptionsCtx(context.Background(), fs, opts)
+}
 
-	res, err := client.Do(req)
+// ListDevicesWithOptionsCtx is like ListDevicesWithOptions but uses the given context for the request.
+func (i IoTA) ListDevicesWithOptionsCtx(ctx context.Context, fs FiwareService, opts ListOptions) (*RespListDevices, error) {
+	var respDevices RespListDevices
+	err := i.do(ctx, request{
+		op:     "ListDevices",
+		method: http.MethodGet,
+		url:    withQuery(i.url(urlDevice), opts.query()),
+		fs:     fs,
+		status: http.StatusOK,
+		out:    &respDevices,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
+		return nil, err
 	}
-	defer res.Body.Close()
+	return &respDevices, nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		err = json.Unmarshal(resData, &apiError)
-		if err != nil {
-			log.Panic().Err(err).Msg("Could not Marshal struct")
+// AllDevices returns an iterator over all devices, requesting pages of opts.Limit devices
+// starting at opts.Offset. Iteration stops after the first error.
+func (i IoTA) AllDevices(ctx context.Context, fs FiwareService, opts ListOptions) iter.Seq2[Device, error] {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultPageSize
+	}
+	return func(yield func(Device, error) bool) {
+		for {
+			page, err := i.ListDevicesWithOptionsCtx(ctx, fs, opts)
+			if err != nil {
+				yield(Device{}, err)
+				return
+			}
+			for _, d := range page.Devices {
+				if !yield(d, nil) {
+					return
+				}
+			}
+			opts.Offset += len(page.Devices)
+			if len(page.Devices) == 0 || opts.Offset >= page.Count {
+				return
+			}
 		}
-		return nil, apiError
 	}
-
-	responseData, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Error while getting service: %w", err)
-	}
-
-	var respDevices respListDevices
-	json.Unmarshal(responseData, &respDevices)
-	return &respDevices, nil
 }
 
 // Method to create a device
 func (i IoTA) CreateDevices(fs FiwareService, ds []Device) error {
+	return i.CreateDevicesCtx(context.Background(), fs, ds)
+}
+
+// CreateDevicesCtx is like CreateDevices but uses the given context for the request.
+func (i IoTA) CreateDevicesCtx(ctx context.Context, fs FiwareService, ds []Device) error {
 	for _, sg := range ds {
 		err := sg.Validate()
 		if err != nil {
@@ -153,143 +161,116 @@ func (i IoTA) CreateDevices(fs FiwareService, ds []Device) error {
 	}
 	rcd := reqCreateDevice{}
 	rcd.Devices = ds[:]
-	method := "POST"
 
 	payload, err := json.Marshal(rcd)
 	if err != nil {
-		log.Panic().Err(err).Msg("Could not Marshal struct")
-	}
-	client := i.Client()
-	req, err := http.NewRequest(method, fmt.Sprintf(urlDevice, i.Host, i.Port), bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("Error while creating Request %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error while requesting resource %w", err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusCreated {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		json.Unmarshal(resData, &apiError)
-		return apiError
-	}
-
-	return nil
+		return fmt.Errorf("Error while encoding devices: %w", err)
+	}
+	var id DeciveId
+	if len(ds) == 1 {
+		id = ds[0].Id
+	}
+
+	err = i.do(ctx, request{
+		op:        "CreateDevices",
+		method:    http.MethodPost,
+		url:       i.url(urlDevice),
+		fs:        fs,
+		id:        id,
+		payload:   payload,
+		status:    http.StatusCreated,
+		duplicate: ErrDuplicateDeviceID,
+	})
+	return err
 }
 
 // Method to create a device
 func (i IoTA) CreateDevice(fs FiwareService, d Device) error {
+	return i.CreateDeviceCtx(context.Background(), fs, d)
+}
+
+// CreateDeviceCtx is like CreateDevice but uses the given context for the request.
+func (i IoTA) CreateDeviceCtx(ctx context.Context, fs FiwareService, d Device) error {
 	ds := [1]Device{d}
-	return i.CreateDevices(fs, ds[:])
+	return i.CreateDevicesCtx(ctx, fs, ds[:])
 }
 
 // Method to update a device
 func (i IoTA) UpdateDevice(fs FiwareService, d Device) error {
+	return i.UpdateDeviceCtx(context.Background(), fs, d)
+}
+
+// UpdateDeviceCtx is like UpdateDevice but uses the given context for the request.
+func (i IoTA) UpdateDeviceCtx(ctx context.Context, fs FiwareService, d Device) error {
 	err := d.Validate()
 	if err != nil {
 		return err
 	}
 
-	url, err := u.JoinPath(fmt.Sprintf(urlDevice, i.Host, i.Port), u.PathEscape(string(d.Id)))
+	id := d.Id
 
 	// Ensure these fields are not set
 	d.Id = ""
 	d.Transport = ""
 	d.Service = ""
 	d.ServicePath = ""
-
-	method := "PUT"
+	d.LastMeasure = nil
 
 	payload, err := json.Marshal(d)
 	if err != nil {
-		log.Panic().Err(err).Msg("Could not Marshal struct")
+		return fmt.Errorf("Error while encoding device: %w", err)
 	}
 	if string(payload) == "{}" {
 		return nil
 	}
-	client := i.Client()
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("Error while creating Request %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error while requesting resource %w", err)
-	}
-	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusNoContent {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		json.Unmarshal(resData, &apiError)
-		return apiError
-	}
-	return nil
+	err = i.do(ctx, request{
+		op:      "UpdateDevice",
+		method:  http.MethodPut,
+		url:     i.url(urlDevice, u.PathEscape(string(id))),
+		fs:      fs,
+		id:      id,
+		payload: payload,
+		status:  http.StatusNoContent,
+	})
+	return err
 }
 
 // Method to delete a device
 func (i IoTA) DeleteDevice(fs FiwareService, id DeciveId) error {
-	url, err := u.JoinPath(fmt.Sprintf(urlDevice, i.Host, i.Port), u.PathEscape(string(id)))
-	if err != nil {
-		return err
-	}
-	method := "DELETE"
-
-	client := i.Client()
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return fmt.Errorf("Error while getting service: %w", err)
-	}
-	req.Header.Add("fiware-service", fs.Service)
-	req.Header.Add("fiware-servicepath", fs.ServicePath)
-
-	res, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error while getting service: %w", err)
-	}
-	defer res.Body.Close()
+	return i.DeleteDeviceCtx(context.Background(), fs, id)
+}
 
-	if res.StatusCode != http.StatusNoContent {
-		resData, err := io.ReadAll(res.Body)
-		if err != nil {
-			return fmt.Errorf("Error while eding response body %w", err)
-		}
-		var apiError ApiError
-		json.Unmarshal(resData, &apiError)
-		return apiError
-	}
-	return nil
+// DeleteDeviceCtx is like DeleteDevice but uses the given context for the request.
+func (i IoTA) DeleteDeviceCtx(ctx context.Context, fs FiwareService, id DeciveId) error {
+	err := i.do(ctx, request{
+		op:     "DeleteDevice",
+		method: http.MethodDelete,
+		url:    i.url(urlDevice, u.PathEscape(string(id))),
+		fs:     fs,
+		id:     id,
+		status: http.StatusNoContent,
+	})
+	return err
 }
 
 // Method to upsert a device
 func (i IoTA) UpsertDevice(fs FiwareService, d Device) error {
-	exists := i.DeviceExists(fs, d.Id)
+	return i.UpsertDeviceCtx(context.Background(), fs, d)
+}
+
+// UpsertDeviceCtx is like UpsertDevice but uses the given context for all requests.
+func (i IoTA) UpsertDeviceCtx(ctx context.Context, fs FiwareService, d Device) error {
+	exists := i.DeviceExistsCtx(ctx, fs, d.Id)
 	if !exists {
-		log.Debug().Msg("Creating device...")
-		err := i.CreateDevice(fs, d)
+		i.log(ctx, slog.LevelDebug, "Creating device...", "service", fs.Service, "servicePath", fs.ServicePath)
+		err := i.CreateDeviceCtx(ctx, fs, d)
 		if err != nil {
 			return err
 		}
 	} else {
-		log.Debug().Msg("Update device...")
-		dTmp, err := i.ReadDevice(fs, d.Id)
+		i.log(ctx, slog.LevelDebug, "Update device...", "service", fs.Service, "servicePath", fs.ServicePath)
+		dTmp, err := i.ReadDeviceCtx(ctx, fs, d.Id)
 		if err != nil {
 			return err
 		}
@@ -300,7 +281,12 @@ func (i IoTA) UpsertDevice(fs FiwareService, d Device) error {
 
 		d.Transport = ""
 		d.EntityName = dTmp.EntityName
-		err = i.UpdateDevice(fs, d)
+		// Carry forward the members of the stored device the SDK does not model
+		extra := Extra{}
+		maps.Copy(extra, dTmp.Extra)
+		maps.Copy(extra, d.Extra)
+		d.Extra = extra
+		err = i.UpdateDeviceCtx(ctx, fs, d)
 		if err != nil {
 			return err
 		}
@@ -310,14 +296,19 @@ func (i IoTA) UpsertDevice(fs FiwareService, d Device) error {
 
 // Creates a device an updates the given Device
 func (i IoTA) CreateDeviceWSE(fs FiwareService, d *Device) error {
+	return i.CreateDeviceWSECtx(context.Background(), fs, d)
+}
+
+// CreateDeviceWSECtx is like CreateDeviceWSE but uses the given context for all requests.
+func (i IoTA) CreateDeviceWSECtx(ctx context.Context, fs FiwareService, d *Device) error {
 	if d == nil {
 		return errors.New("Device reference cannot be nil")
 	}
-	err := i.CreateDevice(fs, *d)
+	err := i.CreateDeviceCtx(ctx, fs, *d)
 	if err != nil {
 		return err
 	}
-	dTmp, err := i.ReadDevice(fs, d.Id)
+	dTmp, err := i.ReadDeviceCtx(ctx, fs, d.Id)
 	if err != nil {
 		return err
 	}
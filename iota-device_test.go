@@ -1,6 +1,10 @@
 package iotagentsdk_test
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	i "github.com/fbuedding/fiware-iot-agent-sdk"
@@ -79,3 +83,53 @@ func TestCreateDeviceWSE(t *testing.T) {
 	}
 	t.Log(dtemp)
 }
+
+func TestReadDeviceCtxCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := iota.ReadDeviceCtx(ctx, fs, deviceId)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestReadDeviceNotFound(t *testing.T) {
+	_, err := iota.ReadDevice(fs, "does_not_exist")
+	if !errors.Is(err, i.ErrDeviceNotFound) || !i.IsNotFound(err) {
+		t.Errorf("Expected device not found, got %v", err)
+	}
+	var apiError i.ApiError
+	if !errors.As(err, &apiError) || apiError.FiwareService != fs {
+		t.Errorf("Expected ApiError for %v, got %v", fs, err)
+	}
+}
+
+func TestDeviceCorrelator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("fiware-correlator", "correlator-"+r.Method)
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"device_id":"` + string(deviceId) + `"}`))
+	}))
+	defer srv.Close()
+	iotaCorr := newTestIoTA(t, srv.URL)
+
+	device, err := iotaCorr.ReadDevice(fs, deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Correlator != "correlator-GET" {
+		t.Errorf("Expected correlator of read, got %q", device.Correlator)
+	}
+
+	var correlator string
+	err = iotaCorr.DeleteDeviceCtx(i.CaptureCorrelator(context.Background(), &correlator), fs, deviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if correlator != "correlator-DELETE" {
+		t.Errorf("Expected correlator of write, got %q", correlator)
+	}
+}
@@ -0,0 +1,48 @@
+package iotagentsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	u "net/url"
+	"strings"
+)
+
+// Do sends a request to an endpoint of the IoT Agent not covered by the SDK.
+// The path, which may contain a query, is resolved against the base url of the IoT Agent.
+// body is sent as is if it is a []byte, encoded as JSON otherwise and omitted if nil.
+// If out is not nil, the body of a successful response is decoded into it, or stored as is
+// if out is a *[]byte.
+// Any 2xx status is treated as success, otherwise the ApiError of the agent is returned.
+// The request passes the same middlewares, retries, authentication and limits as all other methods.
+func (i IoTA) Do(ctx context.Context, method, path string, fs FiwareService, body any, out any) error {
+	ref, err := u.Parse(path)
+	if err != nil {
+		return fmt.Errorf("Error while parsing path: %w", err)
+	}
+	url := i.url(strings.TrimPrefix(ref.EscapedPath(), "/"))
+	if ref.RawQuery != "" {
+		url += "?" + ref.RawQuery
+	}
+
+	var payload []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		payload = b
+	default:
+		payload, err = json.Marshal(b)
+		if err != nil {
+			return fmt.Errorf("Error while encoding body: %w", err)
+		}
+	}
+
+	return i.do(ctx, request{
+		op:      "Do",
+		method:  strings.ToUpper(method),
+		url:     url,
+		fs:      fs,
+		payload: payload,
+		out:     out,
+	})
+}
@@ -0,0 +1,65 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestDo(t *testing.T) {
+	var gotMethod, gotPath, gotQuery, gotService, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotQuery = r.Method, r.URL.Path, r.URL.RawQuery
+		gotService = r.Header.Get("fiware-service")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"level":"DEBUG"}`))
+	}))
+	defer srv.Close()
+	iotaDo := newTestIoTA(t, srv.URL+"/agent")
+
+	var out struct {
+		Level string `json:"level"`
+	}
+	err := iotaDo.Do(context.Background(), http.MethodPut, "/admin/log?level=DEBUG", fs, map[string]string{"a": "b"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != http.MethodPut || gotPath != "/agent/admin/log" || gotQuery != "level=DEBUG" {
+		t.Errorf("Unexpected request %s %s?%s", gotMethod, gotPath, gotQuery)
+	}
+	if gotService != fs.Service {
+		t.Errorf("Expected fiware-service %q, got %q", fs.Service, gotService)
+	}
+	if gotBody != `{"a":"b"}` {
+		t.Errorf("Unexpected body %s", gotBody)
+	}
+	if out.Level != "DEBUG" {
+		t.Errorf("Expected level DEBUG, got %q", out.Level)
+	}
+}
+
+func TestDoNoContent(t *testing.T) {
+	srv, _ := newFlakyServer(t, 0, http.StatusNoContent, "")
+	iotaDo := newTestIoTA(t, srv.URL)
+	var out map[string]any
+	err := iotaDo.Do(context.Background(), http.MethodDelete, "/iot/devices/x", fs, nil, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoApiError(t *testing.T) {
+	srv, _ := newFlakyServer(t, 0, http.StatusNotFound, `{"name":"DEVICE_NOT_FOUND","message":"not found"}`)
+	iotaDo := newTestIoTA(t, srv.URL)
+	err := iotaDo.Do(context.Background(), http.MethodGet, "/iot/devices/x", fs, nil, nil)
+	if !errors.Is(err, i.ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package iotagentsdk
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxSnippetLen is the maximum length of the body snippet of a DecodeError.
+const maxSnippetLen = 512
+
+// ErrorName is the name of an error reported by the IoT Agent.
+// An ApiError matches an ErrorName with errors.Is if the names are equal.
+type ErrorName string
+
+// Error returns the name.
+func (e ErrorName) Error() string {
+	return string(e)
+}
+
+// Errors reported by the IoT Agent, see [errors]: https://github.com/telefonicaid/iotagent-node-lib/blob/master/lib/errors.js
+const (
+	ErrBadRequest                 ErrorName = "BAD_REQUEST"
+	ErrWrongSyntax                ErrorName = "WRONG_SYNTAX"
+	ErrMissingHeaders             ErrorName = "MISSING_HEADERS"
+	ErrMissingAttributes          ErrorName = "MISSING_ATTRIBUTES"
+	ErrMissingConfigParams        ErrorName = "MISSING_CONFIG_PARAMS"
+	ErrUnsupportedContentType     ErrorName = "UNSUPPORTED_CONTENT_TYPE"
+	ErrUnsupportedType            ErrorName = "UNSUPPORTED_TYPE"
+	ErrMismatchedService          ErrorName = "MISMATCHED_SERVICE"
+	ErrDeviceNotFound             ErrorName = "DEVICE_NOT_FOUND"
+	ErrDeviceGroupNotFound        ErrorName = "DEVICE_GROUP_NOT_FOUND"
+	ErrGroupNotFound              ErrorName = "GROUP_NOT_FOUND"
+	ErrEntityNotFound             ErrorName = "ENTITY_NOT_FOUND"
+	ErrTypeNotFound               ErrorName = "TYPE_NOT_FOUND"
+	ErrAttributeNotFound          ErrorName = "ATTRIBUTE_NOT_FOUND"
+	ErrCommandNotFound            ErrorName = "COMMAND_NOT_FOUND"
+	ErrDuplicateDeviceID          ErrorName = "DUPLICATE_DEVICE_ID"
+	ErrDuplicateGroup             ErrorName = "DUPLICATE_GROUP"
+	ErrEntityGenericError         ErrorName = "ENTITY_GENERIC_ERROR"
+	ErrSecurityInformationMissing ErrorName = "SECURITY_INFORMATION_MISSING"
+	ErrTokenRetrievalError        ErrorName = "TOKEN_RETRIEVAL_ERROR"
+	ErrAccessForbidden            ErrorName = "ACCESS_FORBIDDEN"
+	ErrAuthenticationError        ErrorName = "AUTHENTICATION_ERROR"
+	ErrBadAnswer                  ErrorName = "BAD_ANSWER"
+	ErrInternalDbError            ErrorName = "INTERNAL_DB_ERROR"
+)
+
+// Is reports if target is the ErrorName of e.
+func (e ApiError) Is(target error) bool {
+	name, ok := target.(ErrorName)
+	return ok && string(name) == e.Name
+}
+
+// IsNotFound reports if err is because a device, config group or entity was not found.
+func IsNotFound(err error) bool {
+	for _, name := range []ErrorName{ErrDeviceNotFound, ErrDeviceGroupNotFound, ErrGroupNotFound, ErrEntityNotFound} {
+		if errors.Is(err, name) {
+			return true
+		}
+	}
+	var apiError ApiError
+	return errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports if err is an ApiError because a device or config group already exists.
+func IsConflict(err error) bool {
+	for _, name := range []ErrorName{ErrDuplicateDeviceID, ErrDuplicateGroup} {
+		if errors.Is(err, name) {
+			return true
+		}
+	}
+	var apiError ApiError
+	return errors.As(err, &apiError) && apiError.StatusCode == http.StatusConflict
+}
+
+// DecodeError is returned if a response of the IoT Agent cannot be decoded,
+// e.g. because a proxy answered with an html error page or the body is truncated.
+type DecodeError struct {
+	StatusCode  int
+	ContentType string
+	Method      string
+	URL         string
+	// Snippet is the beginning of the body, at most 512 bytes.
+	Snippet string
+	// Correlator is the fiware-correlator of the response.
+	Correlator string
+	Err        error
+}
+
+// newDecodeError creates a DecodeError for the response res to the call.
+func newDecodeError(call *Call, res *response, err error) *DecodeError {
+	snippet := res.body
+	if len(snippet) > maxSnippetLen {
+		snippet = snippet[:maxSnippetLen]
+	}
+	return &DecodeError{
+		StatusCode:  res.status,
+		ContentType: res.header.Get("Content-Type"),
+		Method:      call.Method,
+		URL:         call.URL,
+		Snippet:     string(snippet),
+		Correlator:  res.header.Get(headerCorrelator),
+		Err:         err,
+	}
+}
+
+// Error returns the error as a formatted string.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Unexpected response from IoT Agent to %s %s, status %d, content type %q: %v",
+		e.Method, e.URL, e.StatusCode, e.ContentType, e.Err)
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,72 @@
+package iotagentsdk_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestApiError(t *testing.T) {
+	body := `{"name":"DUPLICATE_GROUP","message":"A service group already exists"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	iotaErr := newTestIoTA(t, srv.URL)
+	err := iotaErr.CreateConfigGroup(fs, sg)
+
+	if !errors.Is(err, i.ErrDuplicateGroup) || errors.Is(err, i.ErrDuplicateDeviceID) {
+		t.Errorf("Unexpected errors.Is result for %v", err)
+	}
+	if !i.IsConflict(err) || i.IsNotFound(err) {
+		t.Errorf("Expected conflict, got %v", err)
+	}
+	var apiError i.ApiError
+	if !errors.As(err, &apiError) {
+		t.Fatalf("Expected ApiError, got %T", err)
+	}
+	if apiError.StatusCode != http.StatusConflict || apiError.Method != http.MethodPost ||
+		apiError.URL != srv.URL+"/iot/services" || apiError.FiwareService != fs || apiError.Body != body {
+		t.Errorf("Unexpected ApiError %+v", apiError)
+	}
+	// ApiError stays comparable, e.g. for err == someApiError
+	if err != error(apiError) {
+		t.Errorf("Expected %v to equal %v", err, apiError)
+	}
+}
+
+func TestIsNotFoundIsConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		notFound bool
+		conflict bool
+	}{
+		{"bare not found", i.ErrDeviceNotFound, true, false},
+		{"wrapped not found", fmt.Errorf("reading device: %w", i.ErrGroupNotFound), true, false},
+		{"api error not found", i.ApiError{Name: string(i.ErrEntityNotFound)}, true, false},
+		{"status not found", i.ApiError{Name: "OTHER", StatusCode: http.StatusNotFound}, true, false},
+		{"bare conflict", i.ErrDuplicateDeviceID, false, true},
+		{"wrapped conflict", fmt.Errorf("creating group: %w", i.ErrDuplicateGroup), false, true},
+		{"wrapped api error conflict", fmt.Errorf("creating device: %w", i.ApiError{Name: string(i.ErrDuplicateDeviceID)}), false, true},
+		{"status conflict", i.ApiError{Name: "OTHER", StatusCode: http.StatusConflict}, false, true},
+		{"other", i.ErrBadRequest, false, false},
+		{"nil", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := i.IsNotFound(tt.err); got != tt.notFound {
+				t.Errorf("IsNotFound(%v) = %v, want %v", tt.err, got, tt.notFound)
+			}
+			if got := i.IsConflict(tt.err); got != tt.conflict {
+				t.Errorf("IsConflict(%v) = %v, want %v", tt.err, got, tt.conflict)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package iotagentsdk
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Extra holds JSON members the SDK does not model, e.g. options of a specific agent or fields
+// of a newer datamodel. They are captured when decoding and emitted again when encoding,
+// so a read-modify-write round trip does not drop them.
+type Extra map[string]json.RawMessage
+
+// knownFields caches the JSON member names of the types with Extra by reflect.Type.
+var knownFields sync.Map
+
+// jsonFields returns the JSON member names of the struct type t.
+func jsonFields(t reflect.Type) map[string]bool {
+	if fields, ok := knownFields.Load(t); ok {
+		return fields.(map[string]bool)
+	}
+	fields := map[string]bool{}
+	for idx := 0; idx < t.NumField(); idx++ {
+		name, _, _ := strings.Cut(t.Field(idx).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	knownFields.Store(t, fields)
+	return fields
+}
+
+// unknownFields returns the members of the JSON object data which are not fields of v.
+func unknownFields(data []byte, v any) (Extra, error) {
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(data, &members)
+	if err != nil {
+		return nil, err
+	}
+	known := jsonFields(reflect.TypeOf(v).Elem())
+	var extra Extra
+	for name, value := range members {
+		if known[name] {
+			continue
+		}
+		if extra == nil {
+			extra = Extra{}
+		}
+		extra[name] = value
+	}
+	return extra, nil
+}
+
+// withExtra adds the members of extra to the JSON object data, members already in data win.
+func withExtra(data []byte, extra Extra) ([]byte, error) {
+	if len(extra) == 0 {
+		return data, nil
+	}
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(data, &members)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, ok := members[name]; !ok {
+			members[name] = value
+		}
+	}
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON decodes the device and captures unknown members in Extra.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	type Alias Device
+	err := json.Unmarshal(data, (*Alias)(d))
+	if err != nil {
+		return err
+	}
+	d.Extra, err = unknownFields(data, d)
+	return err
+}
+
+// UnmarshalJSON decodes the config group and captures unknown members in Extra.
+func (sg *ConfigGroup) UnmarshalJSON(data []byte) error {
+	type Alias ConfigGroup
+	err := json.Unmarshal(data, (*Alias)(sg))
+	if err != nil {
+		return err
+	}
+	sg.Extra, err = unknownFields(data, sg)
+	return err
+}
+
+// MarshalJSON encodes the config group including Extra.
+func (sg ConfigGroup) MarshalJSON() ([]byte, error) {
+	type Alias ConfigGroup
+	data, err := json.Marshal(Alias(sg))
+	if err != nil {
+		return nil, err
+	}
+	return withExtra(data, sg.Extra)
+}
+
+// UnmarshalJSON decodes the attribute and captures unknown members in Extra.
+func (a *Attribute) UnmarshalJSON(data []byte) error {
+	type Alias Attribute
+	err := json.Unmarshal(data, (*Alias)(a))
+	if err != nil {
+		return err
+	}
+	a.Extra, err = unknownFields(data, a)
+	return err
+}
+
+// MarshalJSON encodes the attribute including Extra.
+func (a Attribute) MarshalJSON() ([]byte, error) {
+	type Alias Attribute
+	data, err := json.Marshal(Alias(a))
+	if err != nil {
+		return nil, err
+	}
+	return withExtra(data, a.Extra)
+}
+
+// UnmarshalJSON decodes the lazy attribute and captures unknown members in Extra.
+func (a *LazyAttribute) UnmarshalJSON(data []byte) error {
+	type Alias LazyAttribute
+	err := json.Unmarshal(data, (*Alias)(a))
+	if err != nil {
+		return err
+	}
+	a.Extra, err = unknownFields(data, a)
+	return err
+}
+
+// MarshalJSON encodes the lazy attribute including Extra.
+func (a LazyAttribute) MarshalJSON() ([]byte, error) {
+	type Alias LazyAttribute
+	data, err := json.Marshal(Alias(a))
+	if err != nil {
+		return nil, err
+	}
+	return withExtra(data, a.Extra)
+}
+
+// UnmarshalJSON decodes the static attribute and captures unknown members in Extra.
+func (sa *StaticAttribute) UnmarshalJSON(data []byte) error {
+	type Alias StaticAttribute
+	err := json.Unmarshal(data, (*Alias)(sa))
+	if err != nil {
+		return err
+	}
+	sa.Extra, err = unknownFields(data, sa)
+	return err
+}
+
+// UnmarshalJSON decodes the command and captures unknown members in Extra.
+func (c *Command) UnmarshalJSON(data []byte) error {
+	type Alias Command
+	err := json.Unmarshal(data, (*Alias)(c))
+	if err != nil {
+		return err
+	}
+	c.Extra, err = unknownFields(data, c)
+	return err
+}
+
+// MarshalJSON encodes the command including Extra.
+func (c Command) MarshalJSON() ([]byte, error) {
+	type Alias Command
+	data, err := json.Marshal(Alias(c))
+	if err != nil {
+		return nil, err
+	}
+	return withExtra(data, c.Extra)
+}
@@ -0,0 +1,120 @@
+package iotagentsdk_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+const deviceWithUnknownFields = `{
+	"device_id": "dev",
+	"entity_name": "urn:Thing:dev",
+	"explicitAttrs": false,
+	"customOption": {"a": 1},
+	"attributes": [{"name": "t", "type": "Number", "reverse": [{"expression": "t/10"}]}],
+	"lazy": [{"name": "l", "type": "Number", "lazyOption": true}],
+	"commands": [{"name": "c", "type": "command", "mqtt": {"qos": 1}}],
+	"static_attributes": [{"name": "s", "type": "Text", "value": "x", "staticOption": "y"}]
+}`
+
+func TestExtraRoundTrip(t *testing.T) {
+	var device i.Device
+	err := json.Unmarshal([]byte(deviceWithUnknownFields), &device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(device.Extra["customOption"]) != `{"a": 1}` {
+		t.Errorf("Unexpected extra %v", device.Extra)
+	}
+	if _, ok := device.Extra["device_id"]; ok {
+		t.Error("Expected known fields not to be extra")
+	}
+	if device.Attributes[0].Extra["reverse"] == nil || device.Lazy[0].Extra["lazyOption"] == nil ||
+		device.Commands[0].Extra["mqtt"] == nil || device.StaticAttributes[0].Extra["staticOption"] == nil {
+		t.Errorf("Expected unknown members of attributes to be kept: %+v", device)
+	}
+
+	encoded, err := json.Marshal(&device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected map[string]any
+	json.Unmarshal([]byte(deviceWithUnknownFields), &expected)
+	assertRoundTrip(t, expected, encoded)
+}
+
+func TestExtraDeviceValue(t *testing.T) {
+	device := i.Device{
+		Id:               deviceId,
+		ExplicitAttrs:    "true",
+		StaticAttributes: []i.StaticAttribute{{Name: "s", Type: "Number", Value: "1", Extra: i.Extra{"staticOption": json.RawMessage(`"y"`)}}},
+		Extra:            i.Extra{"customOption": json.RawMessage(`{"a":1}`)},
+	}
+	// Values, not only pointers, are encoded with explicitAttrs converted and Extra kept
+	encoded, err := json.Marshal(struct{ Device i.Device }{device})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"Device": map[string]any{
+		"device_id":         string(deviceId),
+		"explicitAttrs":     true,
+		"customOption":      map[string]any{"a": 1.0},
+		"static_attributes": []any{map[string]any{"name": "s", "type": "Number", "value": 1.0, "staticOption": "y"}},
+	}}
+	assertRoundTrip(t, expected, encoded)
+
+	device.ExplicitAttrs = nil
+	encoded, err = json.Marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	json.Unmarshal(encoded, &got)
+	if _, ok := got["explicitAttrs"]; ok || got["customOption"] == nil {
+		t.Errorf("Expected nil explicitAttrs to be omitted and Extra kept in %s", encoded)
+	}
+}
+
+func TestExtraConfigGroup(t *testing.T) {
+	cg := i.ConfigGroup{Resource: resource, Apikey: apiKey, Extra: i.Extra{"apikey": json.RawMessage(`"other"`), "custom": json.RawMessage(`true`)}}
+	encoded, err := json.Marshal(cg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	json.Unmarshal(encoded, &got)
+	if got["custom"] != true {
+		t.Errorf("Expected custom member in %s", encoded)
+	}
+	if got["apikey"] != apiKey {
+		t.Errorf("Expected modeled field to win over extra in %s", encoded)
+	}
+}
+
+func TestUpsertDeviceKeepsExtra(t *testing.T) {
+	var put map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"device_id":"dev","entity_name":"urn:Thing:dev","customOption":"keep"}`))
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			json.Unmarshal(b, &put)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	iotaExtra := newTestIoTA(t, srv.URL)
+
+	err := iotaExtra.UpsertDevice(fs, i.Device{Id: "dev", EntityType: "Thing", ExplicitAttrs: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if put["customOption"] != "keep" || put["entity_type"] != "Thing" {
+		t.Errorf("Unexpected update %v", put)
+	}
+}
@@ -0,0 +1,194 @@
+package iotagentsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HealthStatus is the health of the IoT Agent as reported by Healthcheck.
+type HealthStatus string
+
+// Health states of the IoT Agent.
+const (
+	// HealthHealthy means the agent answered with complete version information.
+	HealthHealthy HealthStatus = "healthy"
+	// HealthDegraded means the agent answered, but with incomplete or invalid version information.
+	HealthDegraded HealthStatus = "degraded"
+)
+
+// SemVer is a semantic version.
+type SemVer struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+// ParseSemVer parses a semantic version like 4.3.0, 1.2.3-next+build or v2.1.
+// Missing minor and patch versions are 0.
+func ParseSemVer(s string) (SemVer, error) {
+	var v SemVer
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	rest, v.Build, _ = strings.Cut(rest, "+")
+	rest, v.Prerelease, _ = strings.Cut(rest, "-")
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return SemVer{}, fmt.Errorf("Invalid version: %q", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for idx, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return SemVer{}, fmt.Errorf("Invalid version: %q", s)
+		}
+		*numbers[idx] = n
+	}
+	return v, nil
+}
+
+// String returns the version in the form major.minor.patch[-prerelease][+build].
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is lower, equal or greater than o.
+// Versions with prerelease are lower than without, the build is ignored.
+func (v SemVer) Compare(o SemVer) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			if d < 0 {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+	return strings.Compare(v.Prerelease, o.Prerelease)
+}
+
+// UnmarshalJSON decodes the healthcheck and accepts the port as number as well.
+func (r *RespHealthcheck) UnmarshalJSON(data []byte) error {
+	type Alias RespHealthcheck
+	tmp := struct {
+		Port json.RawMessage `json:"port"`
+		*Alias
+	}{Alias: (*Alias)(r)}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	r.Port = ""
+	if len(tmp.Port) > 0 && tmp.Port[0] == '"' {
+		return json.Unmarshal(tmp.Port, &r.Port)
+	}
+	if len(tmp.Port) > 0 && string(tmp.Port) != "null" {
+		r.Port = string(tmp.Port)
+	}
+	return nil
+}
+
+// LibSemVer returns the parsed version of iotagent-node-lib.
+func (r RespHealthcheck) LibSemVer() (SemVer, error) {
+	return ParseSemVer(r.LibVersion)
+}
+
+// AgentSemVer returns the parsed version of the IoT Agent.
+func (r RespHealthcheck) AgentSemVer() (SemVer, error) {
+	return ParseSemVer(r.Version)
+}
+
+// PortNumber returns the port the IoT Agent reports to listen on.
+func (r RespHealthcheck) PortNumber() (int, error) {
+	return strconv.Atoi(r.Port)
+}
+
+// assess sets the status and issues of the healthcheck.
+func (r *RespHealthcheck) assess() {
+	r.Issues = nil
+	if _, err := r.LibSemVer(); err != nil {
+		r.Issues = append(r.Issues, fmt.Sprintf("invalid libVersion %q", r.LibVersion))
+	}
+	if _, err := r.AgentSemVer(); err != nil {
+		r.Issues = append(r.Issues, fmt.Sprintf("invalid version %q", r.Version))
+	}
+	if _, err := r.PortNumber(); err != nil {
+		r.Issues = append(r.Issues, fmt.Sprintf("invalid port %q", r.Port))
+	}
+	if r.BaseRoot == "" {
+		r.Issues = append(r.Issues, "missing baseRoot")
+	}
+	r.Status = HealthHealthy
+	if len(r.Issues) > 0 {
+		r.Status = HealthDegraded
+	}
+}
+
+// Backoff describes how WaitUntilReady waits between two health checks.
+type Backoff struct {
+	// MaxAttempts is the maximum number of health checks, 0 means no limit.
+	MaxAttempts int
+	// MaxElapsed is the maximum time spent waiting, 0 means no limit.
+	MaxElapsed time.Duration
+	// InitialBackoff is the time to wait after the first failed health check, 100ms if not set.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time to wait between two health checks.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the wait grows by with every failed health check.
+	Multiplier float64
+	// Jitter randomizes every wait by up to this fraction, e.g. 0.2 for ±20%.
+	Jitter float64
+}
+
+// WaitUntilReady calls Healthcheck until the IoT Agent answers, waiting between the attempts
+// according to backoff. A degraded agent counts as ready. It gives up when ctx is done or,
+// if set, after backoff.MaxAttempts attempts or backoff.MaxElapsed.
+// The health checks are not retried by the retry policy of i, backoff alone decides when to
+// check again.
+func (i IoTA) WaitUntilReady(ctx context.Context, backoff Backoff) (*RespHealthcheck, error) {
+	policy := RetryPolicy{
+		InitialBackoff: backoff.InitialBackoff,
+		MaxBackoff:     backoff.MaxBackoff,
+		Multiplier:     backoff.Multiplier,
+		Jitter:         backoff.Jitter,
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultRetryPolicy().InitialBackoff
+	}
+	probe := i.withoutRetries()
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		health, err := probe.HealthcheckCtx(ctx)
+		if err == nil {
+			return health, nil
+		}
+		wait := policy.backoff(attempt)
+		if (backoff.MaxAttempts > 0 && attempt >= backoff.MaxAttempts) ||
+			(backoff.MaxElapsed > 0 && time.Since(start)+wait > backoff.MaxElapsed) {
+			return nil, fmt.Errorf("IoT Agent not ready after %d attempts: %w", attempt, err)
+		}
+		i.log(ctx, slog.LevelInfo, "Waiting for IoT Agent", "host", i.Host, "attempt", attempt, "wait", wait, "error", err)
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			return nil, fmt.Errorf("IoT Agent not ready after %d attempts: %w", attempt, err)
+		}
+	}
+}
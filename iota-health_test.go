@@ -0,0 +1,122 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestParseSemVer(t *testing.T) {
+	tests := map[string]i.SemVer{
+		"4.3.0":           {Major: 4, Minor: 3},
+		"v2.1":            {Major: 2, Minor: 1},
+		"1.2.3-next+b.42": {Major: 1, Minor: 2, Patch: 3, Prerelease: "next", Build: "b.42"},
+	}
+	for s, expected := range tests {
+		v, err := i.ParseSemVer(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if v != expected {
+			t.Errorf("%s: expected %+v, got %+v", s, expected, v)
+		}
+	}
+	for _, s := range []string{"", "latest", "1.2.3.4", "1.-2"} {
+		_, err := i.ParseSemVer(s)
+		if err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	parse := func(s string) i.SemVer {
+		v, err := i.ParseSemVer(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"4.3.0", "4.3.0", 0},
+		{"4.3.0", "4.10.0", -1},
+		{"5.0.0", "4.10.0", 1},
+		{"4.3.0-next", "4.3.0", -1},
+		{"4.3.0+a", "4.3.0+b", 0},
+	}
+	for _, test := range tests {
+		if c := parse(test.a).Compare(parse(test.b)); c != test.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", test.a, test.b, test.expected, c)
+		}
+	}
+}
+
+func TestHealthcheckStatus(t *testing.T) {
+	tests := map[string]struct {
+		body   string
+		status i.HealthStatus
+		port   string
+	}{
+		"healthy":     {`{"libVersion":"4.3.0","port":"4061","baseRoot":"/","version":"2.4.0"}`, i.HealthHealthy, "4061"},
+		"port number": {`{"libVersion":"4.3.0","port":4061,"baseRoot":"/","version":"2.4.0"}`, i.HealthHealthy, "4061"},
+		"no version":  {`{"libVersion":"4.3.0","port":"4061","baseRoot":"/"}`, i.HealthDegraded, "4061"},
+		"bad port":    {`{"libVersion":"4.3.0","port":"x","baseRoot":"/","version":"2.4.0"}`, i.HealthDegraded, "x"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, _ := newFlakyServer(t, 0, http.StatusOK, test.body)
+			iotaHealth := newTestIoTA(t, srv.URL, i.WithRetryPolicy(i.RetryPolicy{}))
+			health, err := iotaHealth.Healthcheck()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if health.Status != test.status || health.Port != test.port {
+				t.Errorf("Expected %s with port %s, got %s with port %s: %v", test.status, test.port, health.Status, health.Port, health.Issues)
+			}
+		})
+	}
+}
+
+func TestWaitUntilReady(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"libVersion":"4.3.0","port":"4061","baseRoot":"/","version":"2.4.0"}`))
+	}))
+	defer srv.Close()
+	// The retry policy of the client must not multiply the health checks
+	iotaWait := newTestIoTA(t, srv.URL, i.WithRetryPolicy(fastRetryPolicy()))
+
+	health, err := iotaWait.WaitUntilReady(context.Background(), i.Backoff{InitialBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.LibVersion != "4.3.0" || calls.Load() != 4 {
+		t.Errorf("Unexpected result %+v after %d calls", health, calls.Load())
+	}
+
+	calls.Store(-100)
+	_, err = iotaWait.WaitUntilReady(context.Background(), i.Backoff{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	if err == nil || calls.Load() != -98 {
+		t.Errorf("Expected error after 2 health checks, got %v after %d", err, calls.Load()+100)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = iotaWait.WaitUntilReady(ctx, i.Backoff{InitialBackoff: 5 * time.Millisecond})
+	if err == nil {
+		t.Error("Expected error after context deadline")
+	}
+}
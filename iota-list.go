@@ -0,0 +1,42 @@
+package iotagentsdk
+
+import (
+	u "net/url"
+	"strconv"
+)
+
+// defaultPageSize is the page size of the IoT Agent if no limit is given.
+const defaultPageSize = 20
+
+// ListOptions are the paging options for listing devices and config groups.
+type ListOptions struct {
+	// Limit is the maximum number of entries returned, 0 uses the default of the IoT Agent.
+	Limit int
+	// Offset is the number of entries skipped.
+	Offset int
+	// Detailed requests detailed entries, sent as detailed=on.
+	Detailed bool
+}
+
+// query returns the options as query parameters.
+func (o ListOptions) query() u.Values {
+	q := u.Values{}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.Detailed {
+		q.Set("detailed", "on")
+	}
+	return q
+}
+
+// withQuery appends the query parameters to url, if any.
+func withQuery(url string, q u.Values) string {
+	if len(q) == 0 {
+		return url
+	}
+	return url + "?" + q.Encode()
+}
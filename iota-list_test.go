@@ -0,0 +1,129 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+// newPagingServer returns a server listing total devices and config groups, honouring limit and offset.
+// Config group n is in service path /path_<n%3>.
+func newPagingServer(t *testing.T, total int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil {
+			limit = 20
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		entries := []map[string]any{}
+		for n := offset; n < total && n < offset+limit; n++ {
+			entries = append(entries, map[string]any{
+				"device_id":   fmt.Sprintf("device_%d", n),
+				"apikey":      fmt.Sprintf("key_%d", n),
+				"subservice":  fmt.Sprintf("/path_%d", n%3),
+				"resource":    "/iot/d",
+				"entity_type": "Thing",
+			})
+		}
+		key := "devices"
+		if r.URL.Path == "/iot/services" {
+			key = "services"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"count": total, key: entries})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestListDevicesWithOptions(t *testing.T) {
+	srv, _ := newPagingServer(t, 45)
+	page, err := newTestIoTA(t, srv.URL).ListDevicesWithOptions(fs, i.ListOptions{Limit: 10, Offset: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Count != 45 || len(page.Devices) != 5 || page.Devices[0].Id != "device_40" {
+		t.Errorf("Unexpected page: count %d, %d devices", page.Count, len(page.Devices))
+	}
+}
+
+func TestAllDevices(t *testing.T) {
+	srv, calls := newPagingServer(t, 45)
+	n := 0
+	for device, err := range newTestIoTA(t, srv.URL).AllDevices(context.Background(), fs, i.ListOptions{Limit: 10}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := i.DeciveId(fmt.Sprintf("device_%d", n)); device.Id != expected {
+			t.Errorf("Expected %s, got %s", expected, device.Id)
+		}
+		n++
+	}
+	if n != 45 {
+		t.Errorf("Expected 45 devices, got %d", n)
+	}
+	if calls.Load() != 5 {
+		t.Errorf("Expected 5 pages, got %d", calls.Load())
+	}
+}
+
+func TestAllDevicesBreak(t *testing.T) {
+	srv, calls := newPagingServer(t, 45)
+	for range newTestIoTA(t, srv.URL).AllDevices(context.Background(), fs, i.ListOptions{}) {
+		break
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 page, got %d", calls.Load())
+	}
+}
+
+func TestAllDevicesError(t *testing.T) {
+	srv, _ := newFlakyServer(t, 0, http.StatusBadRequest, `{"name":"BAD_REQUEST","message":"bad"}`)
+	iotaPaging := newTestIoTA(t, srv.URL)
+	for _, err := range iotaPaging.AllDevices(context.Background(), fs, i.ListOptions{}) {
+		if !errors.Is(err, i.ErrBadRequest) {
+			t.Errorf("Expected ErrBadRequest, got %v", err)
+		}
+	}
+}
+
+func TestAllConfigGroups(t *testing.T) {
+	srv, calls := newPagingServer(t, 25)
+	n := 0
+	for cg, err := range newTestIoTA(t, srv.URL).AllConfigGroups(context.Background(), fs, i.ListOptions{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := i.Apikey(fmt.Sprintf("key_%d", n)); cg.Apikey != expected {
+			t.Errorf("Expected %s, got %s", expected, cg.Apikey)
+		}
+		n++
+	}
+	if n != 25 {
+		t.Errorf("Expected 25 config groups, got %d", n)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 pages, got %d", calls.Load())
+	}
+}
+
+func TestGetAllServicePathsForServicePaged(t *testing.T) {
+	srv, _ := newPagingServer(t, 45)
+	servicePaths, err := newTestIoTA(t, srv.URL).GetAllServicePathsForService(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servicePaths) != 3 {
+		t.Errorf("Expected 3 service paths, got %v", servicePaths)
+	}
+}
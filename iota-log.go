@@ -0,0 +1,61 @@
+package iotagentsdk
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/rs/zerolog"
+)
+
+// Logger is used by IoTA to log requests to the IoT Agent.
+// Arguments are alternating keys and values as in log/slog.
+// A *slog.Logger implements Logger, zerolog loggers can be adapted with NewZerologLogger.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...any)
+}
+
+// WithLogger sets the logger of the IoTA. By default nothing is logged.
+func WithLogger(logger Logger) Option {
+	return func(i *IoTA) error {
+		if logger == nil {
+			return errors.New("Logger cannot be nil")
+		}
+		i.logger = logger
+		return nil
+	}
+}
+
+// log logs with the logger of i, if any.
+func (i IoTA) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if i.logger == nil {
+		return
+	}
+	i.logger.Log(ctx, level, msg, args...)
+}
+
+// zerologLogger adapts a zerolog.Logger to Logger.
+type zerologLogger struct {
+	logger zerolog.Logger
+}
+
+// NewZerologLogger returns a Logger writing to the given zerolog logger.
+func NewZerologLogger(logger zerolog.Logger) Logger {
+	return zerologLogger{logger}
+}
+
+// Log implements Logger.
+func (z zerologLogger) Log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	var zlvl zerolog.Level
+	switch {
+	case level < slog.LevelInfo:
+		zlvl = zerolog.DebugLevel
+	case level < slog.LevelWarn:
+		zlvl = zerolog.InfoLevel
+	case level < slog.LevelError:
+		zlvl = zerolog.WarnLevel
+	default:
+		zlvl = zerolog.ErrorLevel
+	}
+	z.logger.WithLevel(zlvl).Ctx(ctx).Fields(args).Msg(msg)
+}
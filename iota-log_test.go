@@ -0,0 +1,68 @@
+package iotagentsdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+	"github.com/rs/zerolog"
+)
+
+func newDevicesServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"count":0,"devices":[]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSlogLogger(t *testing.T) {
+	srv := newDevicesServer(t)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	iotaLog := newTestIoTA(t, srv.URL, i.WithLogger(logger))
+	_, err := iotaLog.ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]any
+	err = json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("Expected one json log record, got %q", buf.String())
+	}
+	if record["method"] != http.MethodGet || record["service"] != service || record["servicePath"] != servicePath {
+		t.Errorf("Unexpected log record %v", record)
+	}
+	if record["status"] != float64(http.StatusOK) || record["url"] != srv.URL+"/iot/devices" {
+		t.Errorf("Unexpected log record %v", record)
+	}
+	if _, ok := record["duration"]; !ok {
+		t.Errorf("Missing duration in log record %v", record)
+	}
+}
+
+func TestZerologLogger(t *testing.T) {
+	srv := newDevicesServer(t)
+	var buf bytes.Buffer
+	logger := i.NewZerologLogger(zerolog.New(&buf).Level(zerolog.DebugLevel))
+	iotaLog := newTestIoTA(t, srv.URL, i.WithLogger(logger))
+	_, err := iotaLog.ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]any
+	err = json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("Expected one json log record, got %q", buf.String())
+	}
+	if record["level"] != "debug" || record["service"] != service || record["status"] != float64(http.StatusOK) {
+		t.Errorf("Unexpected log record %v", record)
+	}
+}
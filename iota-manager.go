@@ -0,0 +1,294 @@
+package iotagentsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	u "net/url"
+
+	"github.com/niemeyer/golang/src/pkg/container/vector"
+)
+
+// Constants
+const (
+	urlProtocols = "/iot/protocols"
+)
+
+// IoTAManager is a client for the FIWARE IoT Agent Manager, which registers the protocols
+// of IoT Agents and forwards config group requests to the agent of a protocol.
+// It shares options, middlewares, retries and authentication with IoTA.
+// As the responses of the manager vary between versions, any 2xx status is treated as success.
+type IoTAManager struct {
+	iota IoTA
+}
+
+// Protocol represents a protocol registered at the IoT Agent Manager.
+type Protocol struct {
+	Protocol    string `json:"protocol"`
+	Description string `json:"description,omitempty"`
+	// IoTAgent is the url of the IoT Agent serving the protocol.
+	IoTAgent string   `json:"iotagent"`
+	Resource Resource `json:"resource"`
+	// Services are the config groups of the IoT Agent.
+	Services []ConfigGroup `json:"services,omitempty"`
+}
+
+// RespListProtocols is a page of protocols.
+type RespListProtocols struct {
+	// Count is the total number of protocols, not only of this page.
+	Count     int        `json:"count"`
+	Protocols []Protocol `json:"protocols"`
+	// Correlator is the fiware-correlator of the response.
+	Correlator string `json:"-"`
+}
+
+func (r *RespListProtocols) setCorrelator(correlator string) { r.Correlator = correlator }
+
+// NewIoTAManager creates a client for the IoT Agent Manager with the given options.
+func NewIoTAManager(host string, port int, opts ...Option) (*IoTAManager, error) {
+	iota, err := NewIoTAgentWithOptions(host, port, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &IoTAManager{iota: *iota}, nil
+}
+
+// Validate checks that the protocol can be registered.
+func (p Protocol) Validate() error {
+	mF := &MissingFields{make(vector.StringVector, 0), "Missing fields"}
+	if p.Protocol == "" {
+		mF.Fields.Push("Protocol")
+	}
+	if p.IoTAgent == "" {
+		mF.Fields.Push("IoTAgent")
+	}
+	if p.Resource == "" {
+		mF.Fields.Push("Resource")
+	}
+	if mF.Fields.Len() == 0 {
+		return nil
+	}
+	return mF
+}
+
+// RegisterProtocol registers the protocol of an IoT Agent.
+func (m IoTAManager) RegisterProtocol(p Protocol) error {
+	return m.RegisterProtocolCtx(context.Background(), p)
+}
+
+// RegisterProtocolCtx is like RegisterProtocol but uses the given context for the request.
+func (m IoTAManager) RegisterProtocolCtx(ctx context.Context, p Protocol) error {
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("Error while encoding protocol: %w", err)
+	}
+	return m.iota.do(ctx, request{
+		op:      "RegisterProtocol",
+		method:  http.MethodPost,
+		url:     m.iota.url(urlProtocols),
+		payload: payload,
+	})
+}
+
+// ListProtocols lists a page of the registered protocols.
+func (m IoTAManager) ListProtocols(opts ListOptions) (*RespListProtocols, error) {
+	return m.ListProtocolsCtx(context.Background(), opts)
+}
+
+// ListProtocolsCtx is like ListProtocols but uses the given context for the request.
+func (m IoTAManager) ListProtocolsCtx(ctx context.Context, opts ListOptions) (*RespListProtocols, error) {
+	var respProtocols RespListProtocols
+	err := m.iota.do(ctx, request{
+		op:     "ListProtocols",
+		method: http.MethodGet,
+		url:    withQuery(m.iota.url(urlProtocols), opts.query()),
+		out:    &respProtocols,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &respProtocols, nil
+}
+
+// DeleteProtocol removes the registration of a protocol.
+func (m IoTAManager) DeleteProtocol(protocol string) error {
+	return m.DeleteProtocolCtx(context.Background(), protocol)
+}
+
+// DeleteProtocolCtx is like DeleteProtocol but uses the given context for the request.
+func (m IoTAManager) DeleteProtocolCtx(ctx context.Context, protocol string) error {
+	if protocol == "" {
+		return errors.New("Protocol cannot be empty")
+	}
+	return m.iota.do(ctx, request{
+		op:     "DeleteProtocol",
+		method: http.MethodDelete,
+		url:    m.iota.url(urlProtocols, u.PathEscape(protocol)),
+	})
+}
+
+// configGroupURL returns the url of the config group identified by r and a, forwarded to the
+// agent of protocol. Empty parameters are omitted.
+func (m IoTAManager) configGroupURL(protocol string, r Resource, a Apikey) string {
+	query := u.Values{}
+	if r != "" {
+		query.Set("resource", string(r))
+	}
+	if a != "" {
+		query.Set("apikey", string(a))
+	}
+	if protocol != "" {
+		query.Set("protocol", protocol)
+	}
+	return withQuery(m.iota.url(urlService), query)
+}
+
+// ReadConfigGroup reads a ConfigGroup from the agent of protocol.
+func (m IoTAManager) ReadConfigGroup(fs FiwareService, protocol string, r Resource, a Apikey) (*RespReadConfigGroup, error) {
+	return m.ReadConfigGroupCtx(context.Background(), fs, protocol, r, a)
+}
+
+// ReadConfigGroupCtx is like ReadConfigGroup but uses the given context for the request.
+func (m IoTAManager) ReadConfigGroupCtx(ctx context.Context, fs FiwareService, protocol string, r Resource, a Apikey) (*RespReadConfigGroup, error) {
+	var respReadConfigGroup RespReadConfigGroup
+	err := m.iota.do(ctx, request{
+		op:       "ReadConfigGroup",
+		method:   http.MethodGet,
+		url:      m.configGroupURL(protocol, r, a),
+		fs:       fs,
+		resource: r,
+		apikey:   a,
+		out:      &respReadConfigGroup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &respReadConfigGroup, nil
+}
+
+// ListConfigGroups lists the ConfigGroups of the agent of protocol, of all agents if protocol is empty.
+func (m IoTAManager) ListConfigGroups(fs FiwareService, protocol string) (*RespReadConfigGroup, error) {
+	return m.ListConfigGroupsCtx(context.Background(), fs, protocol)
+}
+
+// ListConfigGroupsCtx is like ListConfigGroups but uses the given context for the request.
+func (m IoTAManager) ListConfigGroupsCtx(ctx context.Context, fs FiwareService, protocol string) (*RespReadConfigGroup, error) {
+	return m.ReadConfigGroupCtx(ctx, fs, protocol, "", "")
+}
+
+// CreateConfigGroup creates a ConfigGroup at the agent of protocol.
+func (m IoTAManager) CreateConfigGroup(fs FiwareService, protocol string, sg ConfigGroup) error {
+	return m.CreateConfigGroupsCtx(context.Background(), fs, protocol, []ConfigGroup{sg})
+}
+
+// CreateConfigGroupCtx is like CreateConfigGroup but uses the given context for the request.
+func (m IoTAManager) CreateConfigGroupCtx(ctx context.Context, fs FiwareService, protocol string, sg ConfigGroup) error {
+	return m.CreateConfigGroupsCtx(ctx, fs, protocol, []ConfigGroup{sg})
+}
+
+// CreateConfigGroups creates ConfigGroups at the agent of protocol.
+func (m IoTAManager) CreateConfigGroups(fs FiwareService, protocol string, sgs []ConfigGroup) error {
+	return m.CreateConfigGroupsCtx(context.Background(), fs, protocol, sgs)
+}
+
+// CreateConfigGroupsCtx is like CreateConfigGroups but uses the given context for the request.
+func (m IoTAManager) CreateConfigGroupsCtx(ctx context.Context, fs FiwareService, protocol string, sgs []ConfigGroup) error {
+	if protocol == "" {
+		return errors.New("Protocol cannot be empty")
+	}
+	protocols, err := json.Marshal([]string{protocol})
+	if err != nil {
+		return fmt.Errorf("Error while encoding protocol: %w", err)
+	}
+	services := make([]ConfigGroup, 0, len(sgs))
+	for _, sg := range sgs {
+		err := sg.Validate()
+		if err != nil {
+			return err
+		}
+		// The manager expects the protocols of a config group, which the agent does not know
+		sg.Extra = maps.Clone(sg.Extra)
+		if sg.Extra == nil {
+			sg.Extra = Extra{}
+		}
+		sg.Extra["protocol"] = protocols
+		services = append(services, sg)
+	}
+	payload, err := json.Marshal(ReqCreateConfigGroup{Services: services})
+	if err != nil {
+		return fmt.Errorf("Error while encoding config groups: %w", err)
+	}
+	var r Resource
+	var a Apikey
+	if len(sgs) == 1 {
+		r, a = sgs[0].Resource, sgs[0].Apikey
+	}
+
+	return m.iota.do(ctx, request{
+		op:        "CreateConfigGroups",
+		method:    http.MethodPost,
+		url:       m.iota.url(urlService),
+		fs:        fs,
+		resource:  r,
+		apikey:    a,
+		payload:   payload,
+		duplicate: ErrDuplicateGroup,
+	})
+}
+
+// UpdateConfigGroup updates a ConfigGroup at the agent of protocol.
+func (m IoTAManager) UpdateConfigGroup(fs FiwareService, protocol string, r Resource, a Apikey, sg ConfigGroup) error {
+	return m.UpdateConfigGroupCtx(context.Background(), fs, protocol, r, a, sg)
+}
+
+// UpdateConfigGroupCtx is like UpdateConfigGroup but uses the given context for the request.
+func (m IoTAManager) UpdateConfigGroupCtx(ctx context.Context, fs FiwareService, protocol string, r Resource, a Apikey, sg ConfigGroup) error {
+	if protocol == "" {
+		return errors.New("Protocol cannot be empty")
+	}
+	err := sg.Validate()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(sg)
+	if err != nil {
+		return fmt.Errorf("Error while encoding config group: %w", err)
+	}
+
+	return m.iota.do(ctx, request{
+		op:       "UpdateConfigGroup",
+		method:   http.MethodPut,
+		url:      m.configGroupURL(protocol, r, a),
+		fs:       fs,
+		resource: r,
+		apikey:   a,
+		payload:  payload,
+	})
+}
+
+// DeleteConfigGroup deletes a ConfigGroup at the agent of protocol.
+func (m IoTAManager) DeleteConfigGroup(fs FiwareService, protocol string, r Resource, a Apikey) error {
+	return m.DeleteConfigGroupCtx(context.Background(), fs, protocol, r, a)
+}
+
+// DeleteConfigGroupCtx is like DeleteConfigGroup but uses the given context for the request.
+func (m IoTAManager) DeleteConfigGroupCtx(ctx context.Context, fs FiwareService, protocol string, r Resource, a Apikey) error {
+	if protocol == "" {
+		return errors.New("Protocol cannot be empty")
+	}
+	return m.iota.do(ctx, request{
+		op:       "DeleteConfigGroup",
+		method:   http.MethodDelete,
+		url:      m.configGroupURL(protocol, r, a),
+		fs:       fs,
+		resource: r,
+		apikey:   a,
+	})
+}
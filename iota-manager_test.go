@@ -0,0 +1,129 @@
+package iotagentsdk_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+type managerRequest struct {
+	method, path, query, service string
+	body                         map[string]any
+}
+
+// newManagerServer returns a fake IoT Agent Manager recording all requests.
+func newManagerServer(t *testing.T) (*i.IoTAManager, *[]managerRequest) {
+	t.Helper()
+	var requests []managerRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := managerRequest{method: r.Method, path: r.URL.Path, query: r.URL.RawQuery, service: r.Header.Get("fiware-service")}
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &req.body)
+		requests = append(requests, req)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/iot/protocols":
+			w.Write([]byte(`{"count":1,"protocols":[{"protocol":"IoTA-UL","description":"UL","iotagent":"http://ul:4061","resource":"/iot/d"}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/iot/services":
+			w.Write([]byte(`{"count":1,"services":[{"resource":"/iot/d","apikey":"key","entity_type":"Thing"}]}`))
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	m, err := i.NewIoTAManager("", 0, i.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, &requests
+}
+
+func TestManagerProtocols(t *testing.T) {
+	m, requests := newManagerServer(t)
+
+	err := m.RegisterProtocol(i.Protocol{Protocol: "IoTA-UL", IoTAgent: "http://ul:4061", Resource: "/iot/d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[0]; r.method != http.MethodPost || r.path != "/iot/protocols" || r.body["protocol"] != "IoTA-UL" {
+		t.Errorf("Unexpected request %+v", r)
+	}
+
+	protocols, err := m.ListProtocols(i.ListOptions{Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protocols.Count != 1 || protocols.Protocols[0].IoTAgent != "http://ul:4061" {
+		t.Errorf("Unexpected protocols %+v", protocols)
+	}
+	if r := (*requests)[1]; r.query != "limit=5" {
+		t.Errorf("Unexpected query %s", r.query)
+	}
+
+	err = m.DeleteProtocol("IoTA-UL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[2]; r.method != http.MethodDelete || r.path != "/iot/protocols/IoTA-UL" {
+		t.Errorf("Unexpected request %+v", r)
+	}
+
+	err = m.RegisterProtocol(i.Protocol{Protocol: "IoTA-UL"})
+	if err == nil {
+		t.Error("Expected error for incomplete protocol")
+	}
+}
+
+func TestManagerConfigGroups(t *testing.T) {
+	m, requests := newManagerServer(t)
+
+	err := m.CreateConfigGroup(fs, "IoTA-UL", sg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := (*requests)[0]
+	if r.path != "/iot/services" || r.service != service {
+		t.Errorf("Unexpected request %+v", r)
+	}
+	services, _ := r.body["services"].([]any)
+	if len(services) != 1 {
+		t.Fatalf("Expected 1 service in body, got %v", r.body)
+	}
+	if protocol := services[0].(map[string]any)["protocol"]; len(protocol.([]any)) != 1 || protocol.([]any)[0] != "IoTA-UL" {
+		t.Errorf("Unexpected protocol %v", protocol)
+	}
+
+	cgs, err := m.ListConfigGroups(fs, "IoTA-UL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cgs.Count != 1 || (*requests)[1].query != "protocol=IoTA-UL" {
+		t.Errorf("Unexpected result %+v for query %s", cgs, (*requests)[1].query)
+	}
+
+	err = m.UpdateConfigGroup(fs, "IoTA-UL", resource, apiKey, i.ConfigGroup{Resource: resource, Apikey: apiKey, EntityType: "Other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[2]; r.method != http.MethodPut || r.query != "apikey=testKey&protocol=IoTA-UL&resource=%2Fiot%2Fd" {
+		t.Errorf("Unexpected request %+v", r)
+	}
+
+	err = m.DeleteConfigGroup(fs, "IoTA-UL", resource, apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := (*requests)[3]; r.method != http.MethodDelete || r.query != "apikey=testKey&protocol=IoTA-UL&resource=%2Fiot%2Fd" {
+		t.Errorf("Unexpected request %+v", r)
+	}
+
+	err = m.DeleteConfigGroup(fs, "", resource, apiKey)
+	if err == nil {
+		t.Error("Expected error for empty protocol")
+	}
+}
@@ -0,0 +1,55 @@
+package iotagentsdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Call describes a logical operation on the IoT Agent passing through the middleware chain.
+// Middlewares may change the request fields before calling the next Handler.
+type Call struct {
+	// Operation is the name of the IoTA method sending the request, e.g. "CreateDevices".
+	Operation     string
+	FiwareService FiwareService
+	// DeviceId, Resource and Apikey identify the device or config group the call is about.
+	// They are empty for calls about multiple devices or config groups.
+	DeviceId DeciveId
+	Resource Resource
+	Apikey   Apikey
+	Method   string
+	URL      string
+	// Header holds additional headers sent with the request.
+	// The fiware-service and fiware-servicepath headers are always set from FiwareService.
+	Header http.Header
+	// Payload is the encoded body of the request, nil if there is none.
+	Payload []byte
+	// Response is a pointer to the value the response is decoded into, nil if the operation
+	// has no result. It is populated once the next Handler returned without error.
+	Response any
+	// StatusCode is the status code of the last response, 0 if no response was received.
+	StatusCode int
+	// Correlator is the fiware-correlator the IoT Agent answered with.
+	Correlator string
+}
+
+// Handler performs a Call.
+type Handler func(ctx context.Context, call *Call) error
+
+// Middleware wraps the next Handler of the chain, e.g. to inspect or change the Call
+// before and after it is performed or to return without calling next at all.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware appends middlewares to the chain every request passes through.
+// The first middleware is the outermost one.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(i *IoTA) error {
+		for _, m := range middlewares {
+			if m == nil {
+				return errors.New("Middleware cannot be nil")
+			}
+		}
+		i.middlewares = append(i.middlewares, middlewares...)
+		return nil
+	}
+}
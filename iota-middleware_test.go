@@ -0,0 +1,94 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestMiddleware(t *testing.T) {
+	var gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("X-Audit")
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"count":1,"devices":[{"device_id":"test_device"}]}`))
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	var order []string
+	var calls []i.Call
+	audit := func(next i.Handler) i.Handler {
+		return func(ctx context.Context, call *i.Call) error {
+			order = append(order, "audit")
+			call.Header.Set("X-Audit", call.Operation)
+			err := next(ctx, call)
+			calls = append(calls, *call)
+			return err
+		}
+	}
+	inner := func(next i.Handler) i.Handler {
+		return func(ctx context.Context, call *i.Call) error {
+			order = append(order, "inner")
+			return next(ctx, call)
+		}
+	}
+
+	iotaMw := newTestIoTA(t, srv.URL, i.WithMiddleware(audit, inner))
+	_, err := iotaMw.ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = iotaMw.CreateDevice(fs, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != 4 || order[0] != "audit" || order[1] != "inner" {
+		t.Errorf("Unexpected middleware order %v", order)
+	}
+	if gotHeader != "CreateDevices" {
+		t.Errorf("Expected injected header, got %q", gotHeader)
+	}
+	list := calls[0]
+	if list.Operation != "ListDevices" || list.FiwareService != fs || list.StatusCode != http.StatusOK || list.Payload != nil {
+		t.Errorf("Unexpected call %+v", list)
+	}
+	if list.Response == nil {
+		t.Error("Expected decoded response")
+	}
+	create := calls[1]
+	if create.Operation != "CreateDevices" || create.Method != http.MethodPost || len(create.Payload) == 0 {
+		t.Errorf("Unexpected call %+v", create)
+	}
+}
+
+func TestMiddlewareFaultInjection(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	errInjected := errors.New("injected")
+	fault := func(next i.Handler) i.Handler {
+		return func(ctx context.Context, call *i.Call) error {
+			return errInjected
+		}
+	}
+	iotaMw := newTestIoTA(t, srv.URL, i.WithMiddleware(fault))
+	err := iotaMw.DeleteDevice(fs, deviceId)
+	if !errors.Is(err, errInjected) {
+		t.Errorf("Expected injected error, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request, got %d", requests)
+	}
+}
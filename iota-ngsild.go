@@ -0,0 +1,144 @@
+package iotagentsdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	u "net/url"
+	"strings"
+)
+
+// NgsiVersion is the NGSI version an IoT Agent uses for the entities of a device or config group.
+type NgsiVersion string
+
+// NGSI versions of a device or config group. An empty NgsiVersion uses the default of the agent.
+// The mixed mode is a setting of the agent only, it cannot be set per device or config group.
+const (
+	NgsiV2 NgsiVersion = "v2"
+	NgsiLD NgsiVersion = "ld"
+)
+
+// Valid reports if v is empty or a known NGSI version.
+func (v NgsiVersion) Valid() bool {
+	switch v {
+	case "", NgsiV2, NgsiLD:
+		return true
+	}
+	return false
+}
+
+// IsLD reports if entities are provisioned as NGSI-LD.
+func (v NgsiVersion) IsLD() bool {
+	return v == NgsiLD
+}
+
+// NGSI-LD attribute types.
+const (
+	NgsiLDProperty     = "Property"
+	NgsiLDRelationship = "Relationship"
+	NgsiLDGeoProperty  = "GeoProperty"
+)
+
+// ngsiLDPrefix is the prefix of NGSI-LD entity ids built by NgsiLDEntityId.
+const ngsiLDPrefix = "urn:ngsi-ld:"
+
+// ErrInvalidNgsiLD is wrapped by all errors about invalid NGSI-LD provisioning.
+var ErrInvalidNgsiLD = errors.New("Invalid NGSI-LD provisioning")
+
+// NgsiLDEntityId returns the NGSI-LD entity id urn:ngsi-ld:<entityType>:<id>.
+func NgsiLDEntityId(entityType, id string) string {
+	return ngsiLDPrefix + entityType + ":" + id
+}
+
+// ParseNgsiLDEntityId splits an entity id of the form urn:ngsi-ld:<entityType>:<id>.
+func ParseNgsiLDEntityId(entityId string) (entityType string, id string, err error) {
+	rest, ok := strings.CutPrefix(entityId, ngsiLDPrefix)
+	if ok {
+		entityType, id, ok = strings.Cut(rest, ":")
+	}
+	if !ok || entityType == "" || id == "" {
+		return "", "", fmt.Errorf("%w: entity id %q is not of the form %s<type>:<id>", ErrInvalidNgsiLD, entityId, ngsiLDPrefix)
+	}
+	return entityType, id, nil
+}
+
+// isURI reports if s is an absolute URI as required for NGSI-LD entity ids and relationships.
+func isURI(s string) bool {
+	parsed, err := u.Parse(s)
+	return err == nil && parsed.Scheme != "" && (parsed.Opaque != "" || parsed.Host != "")
+}
+
+// staticValue returns the value of sa as sent to the IoT Agent, decoded into a generic value.
+// Values given as JSON strings or typed structs are thereby checked like the agent sees them.
+func staticValue(sa StaticAttribute) (any, error) {
+	data, err := json.Marshal(sa)
+	if err != nil {
+		return nil, err
+	}
+	var decoded struct {
+		Value any `json:"value"`
+	}
+	err = json.Unmarshal(data, &decoded)
+	return decoded.Value, err
+}
+
+// attributeNames returns the names of all attributes and commands.
+func attributeNames(attributes []Attribute, lazy []LazyAttribute, staticAttributes []StaticAttribute, commands []Command) []string {
+	var names []string
+	for _, a := range attributes {
+		names = append(names, a.Name)
+	}
+	for _, a := range lazy {
+		names = append(names, a.Name)
+	}
+	for _, a := range staticAttributes {
+		names = append(names, a.Name)
+	}
+	for _, c := range commands {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// validateNgsiLD validates the NGSI-LD specific fields shared by devices and config groups.
+// names are the names of all attributes, static attributes, lazy attributes and commands.
+func validateNgsiLD(v NgsiVersion, jsonLdContext string, names []string, staticAttributes []StaticAttribute) error {
+	if !v.Valid() {
+		return fmt.Errorf("Unknown NGSI version: %q", v)
+	}
+	if !v.IsLD() {
+		return nil
+	}
+	var errs []error
+	if jsonLdContext != "" && !isURI(jsonLdContext) {
+		errs = append(errs, fmt.Errorf("%w: @context %q is not an absolute URI", ErrInvalidNgsiLD, jsonLdContext))
+	}
+	for _, name := range names {
+		if name == "id" || name == "type" || name == "@context" {
+			errs = append(errs, fmt.Errorf("%w: attribute name %s is reserved", ErrInvalidNgsiLD, name))
+		}
+	}
+	for _, sa := range staticAttributes {
+		if sa.Type != NgsiLDRelationship && sa.Type != NgsiLDGeoProperty {
+			continue
+		}
+		value, err := staticValue(sa)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: value of %s: %w", ErrInvalidNgsiLD, sa.Name, err))
+			continue
+		}
+		switch sa.Type {
+		case NgsiLDRelationship:
+			object, ok := value.(string)
+			if !ok || !isURI(object) {
+				errs = append(errs, fmt.Errorf("%w: relationship %s does not point to an entity id", ErrInvalidNgsiLD, sa.Name))
+			}
+		case NgsiLDGeoProperty:
+			geometry, ok := value.(map[string]any)
+			if !ok || geometry["type"] == nil || (geometry["coordinates"] == nil && geometry["geometries"] == nil) {
+				errs = append(errs, fmt.Errorf("%w: geo property %s is not a GeoJSON geometry", ErrInvalidNgsiLD, sa.Name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package iotagentsdk_test
+
+import (
+	"errors"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestNgsiLDEntityId(t *testing.T) {
+	entityId := i.NgsiLDEntityId("Sensor", "001")
+	if entityId != "urn:ngsi-ld:Sensor:001" {
+		t.Errorf("Unexpected entity id %s", entityId)
+	}
+	entityType, id, err := i.ParseNgsiLDEntityId(entityId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entityType != "Sensor" || id != "001" {
+		t.Errorf("Unexpected type %s and id %s", entityType, id)
+	}
+	for _, invalid := range []string{"Sensor:001", "urn:ngsi-ld:Sensor", "urn:ngsi-ld::001"} {
+		_, _, err := i.ParseNgsiLDEntityId(invalid)
+		if !errors.Is(err, i.ErrInvalidNgsiLD) {
+			t.Errorf("%s: expected ErrInvalidNgsiLD, got %v", invalid, err)
+		}
+	}
+}
+
+func TestValidateNgsiLD(t *testing.T) {
+	ld := i.Device{
+		Id:            "sensor001",
+		EntityName:    i.NgsiLDEntityId("Sensor", "001"),
+		EntityType:    "Sensor",
+		NgsiVersion:   i.NgsiLD,
+		JsonLdContext: "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld",
+		Attributes:    []i.Attribute{{ObjectID: "t", Name: "temperature", Type: i.NgsiLDProperty}},
+		StaticAttributes: []i.StaticAttribute{
+			{Name: "isPartOf", Type: i.NgsiLDRelationship, Value: i.NgsiLDEntityId("Building", "1")},
+			{Name: "location", Type: i.NgsiLDGeoProperty, Value: map[string]any{"type": "Point", "coordinates": []float64{13.4, 52.5}}},
+		},
+	}
+	err := ld.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]func(d *i.Device){
+		"entity name":  func(d *i.Device) { d.EntityName = "Sensor001" },
+		"context":      func(d *i.Device) { d.JsonLdContext = "ngsi-ld-core-context.jsonld" },
+		"relationship": func(d *i.Device) { d.StaticAttributes[0].Value = "Building1" },
+		"geo property": func(d *i.Device) { d.StaticAttributes[1].Value = "52.5,13.4" },
+		"reserved":     func(d *i.Device) { d.Attributes[0].Name = "type" },
+	}
+	for name, invalidate := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := ld
+			d.Attributes = append([]i.Attribute{}, ld.Attributes...)
+			d.StaticAttributes = append([]i.StaticAttribute{}, ld.StaticAttributes...)
+			invalidate(&d)
+			err := d.Validate()
+			if !errors.Is(err, i.ErrInvalidNgsiLD) {
+				t.Errorf("Expected ErrInvalidNgsiLD, got %v", err)
+			}
+		})
+	}
+
+	// The same fields are not checked for NGSI-v2
+	v2 := ld
+	v2.NgsiVersion = i.NgsiV2
+	v2.EntityName = "Sensor001"
+	err = v2.Validate()
+	if err != nil {
+		t.Errorf("Expected NGSI-v2 device to be valid, got %v", err)
+	}
+
+	for _, version := range []i.NgsiVersion{"v3", "mixed"} {
+		unknown := ld
+		unknown.NgsiVersion = version
+		err = unknown.Validate()
+		if err == nil {
+			t.Errorf("Expected error for NGSI version %s of a device", version)
+		}
+	}
+}
+
+func TestValidateNgsiLDStaticValueForms(t *testing.T) {
+	type point struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	}
+	values := map[string]any{
+		"json string": `{"type":"Point","coordinates":[13.4,52.5]}`,
+		"struct":      point{Type: "Point", Coordinates: []float64{13.4, 52.5}},
+		"map":         map[string]any{"type": "Point", "coordinates": []float64{13.4, 52.5}},
+	}
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			d := i.Device{
+				Id:          "sensor001",
+				NgsiVersion: i.NgsiLD,
+				StaticAttributes: []i.StaticAttribute{
+					{Name: "location", Type: i.NgsiLDGeoProperty, Value: value},
+					{Name: "isPartOf", Type: i.NgsiLDRelationship, Value: i.NgsiLDEntityId("Building", "1")},
+				},
+			}
+			err := d.Validate()
+			if err != nil {
+				t.Errorf("Expected valid device, got %v", err)
+			}
+		})
+	}
+
+	type ref struct {
+		Object string `json:"object"`
+	}
+	d := i.Device{
+		Id:               "sensor001",
+		NgsiVersion:      i.NgsiLD,
+		StaticAttributes: []i.StaticAttribute{{Name: "isPartOf", Type: i.NgsiLDRelationship, Value: ref{"urn:ngsi-ld:Building:1"}}},
+	}
+	err := d.Validate()
+	if !errors.Is(err, i.ErrInvalidNgsiLD) {
+		t.Errorf("Expected relationship to an object to be invalid, got %v", err)
+	}
+}
+
+func TestValidateNgsiLDConfigGroup(t *testing.T) {
+	cg := i.ConfigGroup{
+		Resource:         resource,
+		Apikey:           apiKey,
+		NgsiVersion:      i.NgsiLD,
+		StaticAttributes: []i.StaticAttribute{{Name: "isPartOf", Type: i.NgsiLDRelationship, Value: "Building1"}},
+	}
+	err := cg.Validate()
+	if !errors.Is(err, i.ErrInvalidNgsiLD) {
+		t.Errorf("Expected ErrInvalidNgsiLD, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package iotagentsdk
+
+import (
+	"fmt"
+	"net/http"
+	u "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeout is the timeout of the http client created by NewIoTAgentWithOptions
+// if none is set with WithTimeout.
+const defaultTimeout = 30 * time.Second
+
+// Option configures an IoTA created with NewIoTAgentWithOptions.
+type Option func(*IoTA) error
+
+// NewIoTAgentWithOptions creates a new instance of the IoT Agent reachable at host and port
+// and applies the given options in order.
+// Without options the agent is reached via plain http, with TLS options via https and a http client
+// with a timeout of 30s, transient failures are retried according to DefaultRetryPolicy.
+func NewIoTAgentWithOptions(host string, port int, opts ...Option) (*IoTA, error) {
+	retryPolicy := DefaultRetryPolicy()
+	iota := IoTA{
+		Host:        host,
+		Port:        port,
+		headers:     http.Header{},
+		retryPolicy: &retryPolicy,
+	}
+	for _, opt := range opts {
+		err := opt(&iota)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// TLS options imply https, unless the scheme was set explicitly
+	switch {
+	case iota.tlsConfig != nil && iota.scheme == "":
+		iota.scheme = "https"
+	case iota.tlsConfig != nil && iota.scheme != "https":
+		return nil, fmt.Errorf("TLS options require the https scheme, got %q", iota.scheme)
+	case iota.scheme == "":
+		iota.scheme = defaultScheme
+	}
+
+	timeout := iota.timeout_ms
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	if iota.client != nil {
+		tmp := *iota.client
+		client = &tmp
+		if iota.timeout_ms != 0 {
+			client.Timeout = iota.timeout_ms
+		}
+	}
+	if iota.tlsConfig != nil {
+		transport, err := iota.tlsTransport()
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	} else if iota.transport != nil {
+		client.Transport = iota.transport
+	}
+	iota.client = client
+	return &iota, nil
+}
+
+// WithScheme sets the scheme used to reach the IoT Agent, either "http" or "https".
+func WithScheme(scheme string) Option {
+	return func(i *IoTA) error {
+		scheme = strings.ToLower(scheme)
+		if scheme != "http" && scheme != "https" {
+			return fmt.Errorf("Unsupported scheme %q, must be http or https", scheme)
+		}
+		i.scheme = scheme
+		return nil
+	}
+}
+
+// WithBaseURL sets scheme, host, port and path prefix from the given url,
+// e.g. "https://gateway/iota-ul/". If the url has no port, none is sent.
+func WithBaseURL(rawURL string) Option {
+	return func(i *IoTA) error {
+		base, err := u.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("Invalid base url %q: %w", rawURL, err)
+		}
+		if base.Host == "" {
+			return fmt.Errorf("Invalid base url %q: missing host", rawURL)
+		}
+		err = WithScheme(base.Scheme)(i)
+		if err != nil {
+			return err
+		}
+		i.Host = base.Hostname()
+		i.Port = 0
+		if base.Port() != "" {
+			i.Port, err = strconv.Atoi(base.Port())
+			if err != nil {
+				return fmt.Errorf("Invalid base url %q: %w", rawURL, err)
+			}
+		}
+		i.basePath = base.Path
+		return nil
+	}
+}
+
+// WithBasePath sets a path prefix every endpoint of the IoT Agent is resolved against,
+// e.g. "/iota-ul" when the agent is exposed behind a path based ingress.
+func WithBasePath(basePath string) Option {
+	return func(i *IoTA) error {
+		i.basePath = basePath
+		return nil
+	}
+}
+
+// WithHTTPClient sets the http client used for communication with the IoT Agent.
+// The client is copied, so later changes to it have no effect.
+func WithHTTPClient(client *http.Client) Option {
+	return func(i *IoTA) error {
+		if client == nil {
+			return fmt.Errorf("HTTP client cannot be nil")
+		}
+		i.client = client
+		return nil
+	}
+}
+
+// WithTransport sets the transport used for communication with the IoT Agent.
+// It takes precedence over the transport of a client set with WithHTTPClient.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(i *IoTA) error {
+		if transport == nil {
+			return fmt.Errorf("Transport cannot be nil")
+		}
+		i.transport = transport
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of every request to the IoT Agent, 30s if not set.
+func WithTimeout(timeout time.Duration) Option {
+	return func(i *IoTA) error {
+		i.timeout_ms = timeout
+		return nil
+	}
+}
+
+// WithHeader adds a header which is sent with every request.
+// The fiware-service and fiware-servicepath headers cannot be overwritten.
+func WithHeader(key, value string) Option {
+	return func(i *IoTA) error {
+		i.headers.Add(key, value)
+		return nil
+	}
+}
+
+// WithHeaders adds all given headers, see WithHeader.
+func WithHeaders(headers http.Header) Option {
+	return func(i *IoTA) error {
+		for key, values := range headers {
+			for _, value := range values {
+				i.headers.Add(key, value)
+			}
+		}
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(i *IoTA) error {
+		i.userAgent = userAgent
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package iotagentsdk_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestNewIoTAgentWithOptions(t *testing.T) {
+	var gotPath string
+	var gotHeader http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotHeader = r.Header
+		w.Write([]byte(`{"count":0,"devices":[]}`))
+	}))
+	defer srv.Close()
+
+	iotaOpts, err := i.NewIoTAgentWithOptions("", 0,
+		i.WithBaseURL(srv.URL+"/iota-ul/"),
+		i.WithTimeout(time.Second),
+		i.WithHeader("X-Test", "test"),
+		i.WithUserAgent("sdk-test"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = iotaOpts.ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/iota-ul/iot/devices" {
+		t.Errorf("Unexpected path %s", gotPath)
+	}
+	if gotHeader.Get("X-Test") != "test" {
+		t.Errorf("Missing default header")
+	}
+	if gotHeader.Get("User-Agent") != "sdk-test" {
+		t.Errorf("Unexpected user agent %s", gotHeader.Get("User-Agent"))
+	}
+	if gotHeader.Get("fiware-service") != service {
+		t.Errorf("Unexpected fiware-service %s", gotHeader.Get("fiware-service"))
+	}
+}
+
+func TestNewIoTAgentWithOptionsTimeout(t *testing.T) {
+	iotaDefault, err := i.NewIoTAgentWithOptions("localhost", 4061)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iotaDefault.Client().Timeout != 30*time.Second {
+		t.Errorf("Expected default timeout of 30s, got %v", iotaDefault.Client().Timeout)
+	}
+	iotaTimeout, err := i.NewIoTAgentWithOptions("localhost", 4061, i.WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iotaTimeout.Client().Timeout != time.Second {
+		t.Errorf("Expected timeout of 1s, got %v", iotaTimeout.Client().Timeout)
+	}
+}
+
+func TestNewIoTAgentWithOptionsInvalid(t *testing.T) {
+	_, err := i.NewIoTAgentWithOptions("localhost", 4061, i.WithScheme("ftp"))
+	if err == nil {
+		t.Error("Expected error for unsupported scheme")
+	}
+	_, err = i.NewIoTAgentWithOptions("", 0, i.WithBaseURL("/iota-ul"))
+	if err == nil {
+		t.Error("Expected error for base url without host")
+	}
+}
@@ -0,0 +1,116 @@
+package iotagentsdk
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsNamespace is the namespace of all Prometheus metrics of the SDK.
+const metricsNamespace = "iotagentsdk"
+
+// MetricsCollector collects Prometheus metrics about the operations an IoTA performs.
+// All metrics except the circuit breaker state are labeled with the host of the IoT Agent,
+// the fiware-service and the operation.
+// A MetricsCollector can be shared by multiple IoTAs.
+type MetricsCollector struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+	// circuitState is labeled with the host only.
+	circuitState *prometheus.GaugeVec
+}
+
+// NewMetricsCollector creates a MetricsCollector and registers its metrics with reg.
+func NewMetricsCollector(reg prometheus.Registerer) (*MetricsCollector, error) {
+	labels := []string{"host", "service", "operation"}
+	mc := &MetricsCollector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Number of operations performed on the IoT Agent by status code, 0 if no response was received.",
+		}, append(labels, "code")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of operations performed on the IoT Agent including retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "errors_total",
+			Help:      "Number of failed operations by the name of the error reported by the IoT Agent, or decode, circuit_open or transport.",
+		}, append(labels, "error")),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "retries_total",
+			Help:      "Number of retried requests.",
+		}, labels),
+		circuitState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breaker, 0 closed, 1 open, 2 half-open.",
+		}, []string{"host"}),
+	}
+	for _, c := range []prometheus.Collector{mc.requests, mc.duration, mc.errors, mc.retries, mc.circuitState} {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mc, nil
+}
+
+// WithMetrics enables the collection of Prometheus metrics with the given MetricsCollector.
+func WithMetrics(mc *MetricsCollector) Option {
+	return func(i *IoTA) error {
+		if mc == nil {
+			return errors.New("Metrics collector cannot be nil")
+		}
+		i.metrics = mc
+		return nil
+	}
+}
+
+// errorLabel returns the value of the error label for err.
+func errorLabel(err error) string {
+	var apiError ApiError
+	var decodeErr *DecodeError
+	switch {
+	case errors.As(err, &apiError):
+		return apiError.Name
+	case errors.As(err, &decodeErr):
+		return "decode"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	default:
+		return "transport"
+	}
+}
+
+// observe returns a Middleware recording the metrics of every call.
+func (i IoTA) observe(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		start := time.Now()
+		err := next(ctx, call)
+		labels := prometheus.Labels{"host": i.Host, "service": call.FiwareService.Service, "operation": call.Operation}
+		i.metrics.duration.With(labels).Observe(time.Since(start).Seconds())
+		i.metrics.requests.MustCurryWith(labels).WithLabelValues(strconv.Itoa(call.StatusCode)).Inc()
+		if err != nil {
+			i.metrics.errors.MustCurryWith(labels).WithLabelValues(errorLabel(err)).Inc()
+		}
+		return err
+	}
+}
+
+// retried records a retry of the call, if metrics are enabled.
+func (i IoTA) retried(call *Call) {
+	if i.metrics == nil {
+		return
+	}
+	i.metrics.retries.WithLabelValues(i.Host, call.FiwareService.Service, call.Operation).Inc()
+}
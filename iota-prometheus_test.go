@@ -0,0 +1,80 @@
+package iotagentsdk_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/iot/about":
+			w.Write([]byte(`{"libVersion":"4.0.0","port":"4041","baseRoot":"/","version":"1.0.0"}`))
+		case r.Method == http.MethodGet && calls.Add(1) == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"count":0,"devices":[]}`))
+		default:
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"name":"DUPLICATE_GROUP","message":"A service group already exists"}`))
+		}
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	mc, err := i.NewMetricsCollector(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iotaMetrics := newTestIoTA(t, srv.URL, i.WithMetrics(mc), i.WithRetryPolicy(fastRetryPolicy()))
+	iotaMetrics.ListDevices(fs)
+	iotaMetrics.CreateConfigGroup(fs, sg)
+	iotaMetrics.Healthcheck()
+
+	host := iotaMetrics.Host
+	expected := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"iotagentsdk_requests_total", map[string]string{"host": host, "service": service, "operation": "ListDevices", "code": "200"}, 1},
+		{"iotagentsdk_requests_total", map[string]string{"host": host, "service": service, "operation": "CreateConfigGroups", "code": "409"}, 1},
+		{"iotagentsdk_requests_total", map[string]string{"host": host, "service": "", "operation": "Healthcheck", "code": "200"}, 1},
+		{"iotagentsdk_retries_total", map[string]string{"host": host, "service": service, "operation": "ListDevices"}, 1},
+		{"iotagentsdk_errors_total", map[string]string{"host": host, "service": service, "operation": "CreateConfigGroups", "error": "DUPLICATE_GROUP"}, 1},
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range expected {
+		var got float64
+		for _, mf := range families {
+			if mf.GetName() != e.name {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				match := len(m.GetLabel()) == len(e.labels)
+				for _, l := range m.GetLabel() {
+					match = match && e.labels[l.GetName()] == l.GetValue()
+				}
+				if match {
+					got = m.GetCounter().GetValue()
+				}
+			}
+		}
+		if got != e.value {
+			t.Errorf("Expected %s%v = %v, got %v", e.name, e.labels, e.value, got)
+		}
+	}
+	if n := testutil.CollectAndCount(reg, "iotagentsdk_request_duration_seconds"); n != 3 {
+		t.Errorf("Expected 3 duration histograms, got %d", n)
+	}
+}
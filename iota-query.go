@@ -0,0 +1,150 @@
+package iotagentsdk
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"slices"
+)
+
+// DeviceQuery filters devices on the client side. All conditions must match.
+// The zero value matches all devices. Conditions are added by the methods of
+// DeviceQuery, each returning a new query:
+//
+//	q := DeviceQuery{}.EntityType("Sensor").Transport("MQTT").HasAttribute("temperature")
+type DeviceQuery struct {
+	conditions []func(Device) bool
+}
+
+// and returns a copy of q with the condition added.
+func (q DeviceQuery) and(cond func(Device) bool) DeviceQuery {
+	return DeviceQuery{conditions: append(slices.Clip(q.conditions), cond)}
+}
+
+// Match reports if d matches all conditions of q.
+func (q DeviceQuery) Match(d Device) bool {
+	for _, cond := range q.conditions {
+		if !cond(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// Where adds a custom condition.
+func (q DeviceQuery) Where(cond func(Device) bool) DeviceQuery {
+	return q.and(cond)
+}
+
+// Not adds the negation of all conditions of other.
+func (q DeviceQuery) Not(other DeviceQuery) DeviceQuery {
+	return q.and(func(d Device) bool { return !other.Match(d) })
+}
+
+// Or adds a condition matching if any of the queries matches.
+func (q DeviceQuery) Or(queries ...DeviceQuery) DeviceQuery {
+	return q.and(func(d Device) bool {
+		return slices.ContainsFunc(queries, func(q DeviceQuery) bool { return q.Match(d) })
+	})
+}
+
+// Id matches devices with the given id.
+func (q DeviceQuery) Id(id DeciveId) DeviceQuery {
+	return q.and(func(d Device) bool { return d.Id == id })
+}
+
+// EntityName matches devices with the given entity name.
+func (q DeviceQuery) EntityName(name string) DeviceQuery {
+	return q.and(func(d Device) bool { return d.EntityName == name })
+}
+
+// EntityType matches devices with the given entity type.
+func (q DeviceQuery) EntityType(t string) DeviceQuery {
+	return q.and(func(d Device) bool { return d.EntityType == t })
+}
+
+// ServicePath matches devices in the given service path.
+func (q DeviceQuery) ServicePath(servicePath string) DeviceQuery {
+	return q.and(func(d Device) bool { return d.ServicePath == servicePath })
+}
+
+// Apikey matches devices with the given apikey.
+func (q DeviceQuery) Apikey(a Apikey) DeviceQuery {
+	return q.and(func(d Device) bool { return d.Apikey == a })
+}
+
+// Protocol matches devices with the given protocol.
+func (q DeviceQuery) Protocol(protocol string) DeviceQuery {
+	return q.and(func(d Device) bool { return d.Protocol == protocol })
+}
+
+// Transport matches devices with the given transport.
+func (q DeviceQuery) Transport(transport string) DeviceQuery {
+	return q.and(func(d Device) bool { return d.Transport == transport })
+}
+
+// HasAttribute matches devices with an active or lazy attribute with the given name or object id.
+func (q DeviceQuery) HasAttribute(name string) DeviceQuery {
+	return q.and(func(d Device) bool {
+		return slices.ContainsFunc(d.Attributes, func(a Attribute) bool { return a.Name == name || a.ObjectID == name }) ||
+			slices.ContainsFunc(d.Lazy, func(a LazyAttribute) bool { return a.Name == name || a.ObjectID == name })
+	})
+}
+
+// HasCommand matches devices with a command with the given name or object id.
+func (q DeviceQuery) HasCommand(name string) DeviceQuery {
+	return q.and(func(d Device) bool {
+		return slices.ContainsFunc(d.Commands, func(c Command) bool { return c.Name == name || c.ObjectID == name })
+	})
+}
+
+// HasStaticAttribute matches devices with a static attribute with the given name.
+func (q DeviceQuery) HasStaticAttribute(name string) DeviceQuery {
+	return q.and(func(d Device) bool {
+		return slices.ContainsFunc(d.StaticAttributes, func(sa StaticAttribute) bool { return sa.Name == name })
+	})
+}
+
+// StaticAttribute matches devices with a static attribute with the given name and value.
+// Values are compared by their string representation.
+func (q DeviceQuery) StaticAttribute(name string, value any) DeviceQuery {
+	want := fmt.Sprint(value)
+	return q.and(func(d Device) bool {
+		return slices.ContainsFunc(d.StaticAttributes, func(sa StaticAttribute) bool {
+			return sa.Name == name && fmt.Sprint(sa.Value) == want
+		})
+	})
+}
+
+// FindDevices returns an iterator over all devices matching q, walking all pages of devices.
+// Iteration stops after the first error.
+func (i IoTA) FindDevices(ctx context.Context, fs FiwareService, q DeviceQuery) iter.Seq2[Device, error] {
+	return func(yield func(Device, error) bool) {
+		for d, err := range i.AllDevices(ctx, fs, ListOptions{}) {
+			if err != nil {
+				yield(Device{}, err)
+				return
+			}
+			if q.Match(d) && !yield(d, nil) {
+				return
+			}
+		}
+	}
+}
+
+// FindDevice returns the first device matching q. If no device matches, an error matching
+// ErrDeviceNotFound is returned.
+func (i IoTA) FindDevice(ctx context.Context, fs FiwareService, q DeviceQuery) (*Device, error) {
+	for d, err := range i.FindDevices(ctx, fs, q) {
+		if err != nil {
+			return nil, err
+		}
+		return &d, nil
+	}
+	return nil, fmt.Errorf("No device matches query: %w", ErrDeviceNotFound)
+}
+
+// FindDeviceByEntityName returns the device provisioning the entity with the given name.
+func (i IoTA) FindDeviceByEntityName(ctx context.Context, fs FiwareService, entityName string) (*Device, error) {
+	return i.FindDevice(ctx, fs, DeviceQuery{}.EntityName(entityName))
+}
@@ -0,0 +1,92 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestDeviceQueryMatch(t *testing.T) {
+	sensor := i.Device{
+		Id:               "sensor_1",
+		EntityName:       "urn:Sensor:1",
+		EntityType:       "Sensor",
+		ServicePath:      "/sensors",
+		Apikey:           "key",
+		Transport:        "MQTT",
+		Attributes:       []i.Attribute{{ObjectID: "t", Name: "temperature", Type: "Number"}},
+		Lazy:             []i.LazyAttribute{{Name: "battery", Type: "Number"}},
+		Commands:         []i.Command{{Name: "reset", Type: "command"}},
+		StaticAttributes: []i.StaticAttribute{{Name: "floor", Type: "Number", Value: 3}},
+	}
+	tests := map[string]struct {
+		q     i.DeviceQuery
+		match bool
+	}{
+		"empty":                 {i.DeviceQuery{}, true},
+		"combined":              {i.DeviceQuery{}.ServicePath("/sensors").EntityType("Sensor").Transport("MQTT").HasAttribute("temperature"), true},
+		"attribute object id":   {i.DeviceQuery{}.HasAttribute("t"), true},
+		"lazy attribute":        {i.DeviceQuery{}.HasAttribute("battery"), true},
+		"missing attribute":     {i.DeviceQuery{}.HasAttribute("humidity"), false},
+		"command":               {i.DeviceQuery{}.HasCommand("reset"), true},
+		"static attribute":      {i.DeviceQuery{}.HasStaticAttribute("floor"), true},
+		"static attribute val":  {i.DeviceQuery{}.StaticAttribute("floor", "3"), true},
+		"static attribute diff": {i.DeviceQuery{}.StaticAttribute("floor", 4), false},
+		"wrong transport":       {i.DeviceQuery{}.EntityType("Sensor").Transport("HTTP"), false},
+		"apikey":                {i.DeviceQuery{}.Apikey("key").Id("sensor_1"), true},
+		"or":                    {i.DeviceQuery{}.Or(i.DeviceQuery{}.Transport("HTTP"), i.DeviceQuery{}.Transport("MQTT")), true},
+		"not":                   {i.DeviceQuery{}.Not(i.DeviceQuery{}.EntityType("Sensor")), false},
+		"where":                 {i.DeviceQuery{}.Where(func(d i.Device) bool { return len(d.Commands) == 1 }), true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if test.q.Match(sensor) != test.match {
+				t.Errorf("Expected match %v", test.match)
+			}
+		})
+	}
+}
+
+func TestDeviceQueryImmutable(t *testing.T) {
+	base := i.DeviceQuery{}.EntityType("Sensor")
+	a := base.Transport("MQTT")
+	b := base.Transport("HTTP")
+	d := i.Device{EntityType: "Sensor", Transport: "MQTT"}
+	if !a.Match(d) || b.Match(d) || !base.Match(d) {
+		t.Error("Expected derived queries not to share conditions")
+	}
+}
+
+func TestFindDevice(t *testing.T) {
+	srv, calls := newPagingServer(t, 45)
+	iotaQuery := newTestIoTA(t, srv.URL)
+
+	found, err := iotaQuery.FindDevice(context.Background(), fs, i.DeviceQuery{}.Apikey("key_30"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Id != "device_30" {
+		t.Errorf("Expected device_30, got %s", found.Id)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected to stop after 2 pages, got %d", calls.Load())
+	}
+
+	_, err = iotaQuery.FindDeviceByEntityName(context.Background(), fs, "unknown")
+	if !i.IsNotFound(err) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+
+	n := 0
+	for _, err := range iotaQuery.FindDevices(context.Background(), fs, i.DeviceQuery{}.Where(func(d i.Device) bool { return d.Apikey < "key_2" })) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	// key_0, key_1, key_10 ... key_19
+	if n != 12 {
+		t.Errorf("Expected 12 devices, got %d", n)
+	}
+}
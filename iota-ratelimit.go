@@ -0,0 +1,129 @@
+package iotagentsdk
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the requests an IoTA sends to the IoT Agent.
+// Every attempt counts, including retries and healthchecks.
+type RateLimit struct {
+	// Rate is the number of requests per second, 0 means unlimited.
+	Rate float64
+	// Burst is the number of requests which can be sent at once, defaults to 1.
+	Burst int
+	// MaxInFlight is the maximum number of concurrent requests, 0 means unlimited.
+	MaxInFlight int
+	// PerService applies the limits per fiware-service instead of per IoTA.
+	PerService bool
+}
+
+// WithRateLimit limits the rate and concurrency of the requests to the IoT Agent.
+// Waiting for the limits honours the context of the request.
+// The limits are shared by all copies of the IoTA.
+func WithRateLimit(rl RateLimit) Option {
+	return func(i *IoTA) error {
+		if rl.Rate < 0 || rl.Burst < 0 || rl.MaxInFlight < 0 {
+			return errors.New("Rate limit cannot be negative")
+		}
+		if rl.Burst == 0 {
+			rl.Burst = 1
+		}
+		i.limiter = &limiter{config: rl, limits: map[string]*limit{}}
+		return nil
+	}
+}
+
+// limiter holds the limits of an IoTA, one per fiware-service if configured.
+type limiter struct {
+	config RateLimit
+
+	mu     sync.Mutex
+	limits map[string]*limit
+}
+
+// limit is a token bucket combined with a semaphore.
+type limit struct {
+	rate  float64
+	burst float64
+	slots chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// get returns the limit for the service.
+func (l *limiter) get(service string) *limit {
+	if !l.config.PerService {
+		service = ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lim, ok := l.limits[service]
+	if !ok {
+		lim = &limit{
+			rate:   l.config.Rate,
+			burst:  float64(l.config.Burst),
+			tokens: float64(l.config.Burst),
+			last:   time.Now(),
+		}
+		if l.config.MaxInFlight > 0 {
+			lim.slots = make(chan struct{}, l.config.MaxInFlight)
+		}
+		l.limits[service] = lim
+	}
+	return lim
+}
+
+// acquire waits until a request for the service may be sent.
+// The returned function must be called once the request is done.
+func (l *limiter) acquire(ctx context.Context, service string) (func(), error) {
+	lim := l.get(service)
+	release := func() {}
+	if lim.slots != nil {
+		select {
+		case lim.slots <- struct{}{}:
+			release = func() { <-lim.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	err := lim.wait(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait takes a token from the bucket, waiting until one is available.
+func (lim *limit) wait(ctx context.Context) error {
+	if lim.rate == 0 {
+		return nil
+	}
+	lim.mu.Lock()
+	now := time.Now()
+	lim.tokens = math.Min(lim.burst, lim.tokens+now.Sub(lim.last).Seconds()*lim.rate)
+	lim.last = now
+	// Reserve the token, the bucket may go negative for waiting requests
+	lim.tokens--
+	if lim.tokens >= 0 {
+		lim.mu.Unlock()
+		return nil
+	}
+	delay := time.Duration(-lim.tokens / lim.rate * float64(time.Second))
+	lim.mu.Unlock()
+
+	err := sleep(ctx, delay)
+	if err != nil {
+		lim.mu.Lock()
+		lim.tokens++
+		lim.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+func TestRateLimit(t *testing.T) {
+	srv, calls := newFlakyServer(t, 0, http.StatusOK, `{"count":0,"devices":[]}`)
+	iotaRL := newTestIoTA(t, srv.URL, i.WithRateLimit(i.RateLimit{Rate: 50, Burst: 1}))
+
+	start := time.Now()
+	for n := 0; n < 5; n++ {
+		_, err := iotaRL.ListDevices(fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first request uses the burst, the other 4 wait 20ms each
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("Expected requests to be rate limited, took %s", elapsed)
+	}
+	if calls.Load() != 5 {
+		t.Errorf("Expected 5 calls, got %d", calls.Load())
+	}
+}
+
+func TestRateLimitPerService(t *testing.T) {
+	srv, _ := newFlakyServer(t, 0, http.StatusOK, `{"count":0,"devices":[]}`)
+	iotaRL := newTestIoTA(t, srv.URL, i.WithRateLimit(i.RateLimit{Rate: 1, Burst: 1, PerService: true}))
+
+	start := time.Now()
+	for _, service := range []string{"a", "b", "c"} {
+		_, err := iotaRL.ListDevices(i.FiwareService{Service: service, ServicePath: "/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected services to be limited independently, took %s", elapsed)
+	}
+}
+
+func TestRateLimitContext(t *testing.T) {
+	srv, calls := newFlakyServer(t, 0, http.StatusOK, `{"count":0,"devices":[]}`)
+	iotaRL := newTestIoTA(t, srv.URL, i.WithRateLimit(i.RateLimit{Rate: 0.1, Burst: 1}))
+
+	_, err := iotaRL.ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = iotaRL.ListDevicesCtx(ctx, fs)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 call, got %d", calls.Load())
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(`{"count":0,"devices":[]}`))
+	}))
+	defer srv.Close()
+	iotaRL := newTestIoTA(t, srv.URL, i.WithRateLimit(i.RateLimit{MaxInFlight: 2}))
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := iotaRL.ListDevices(fs)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInFlight.Load() > 2 {
+		t.Errorf("Expected at most 2 concurrent requests, got %d", maxInFlight.Load())
+	}
+}
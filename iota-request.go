@@ -0,0 +1,284 @@
+package iotagentsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	u "net/url"
+	"strconv"
+	"time"
+)
+
+// url resolves the given path elements against the base url of the IoT Agent.
+// The elements are expected to be escaped already.
+func (i IoTA) url(elem ...string) string {
+	scheme := i.scheme
+	if scheme == "" {
+		scheme = defaultScheme
+	}
+	host := i.Host
+	if i.Port != 0 {
+		host = net.JoinHostPort(i.Host, strconv.Itoa(i.Port))
+	}
+	base := &u.URL{Scheme: scheme, Host: host, Path: i.basePath}
+	return base.JoinPath(elem...).String()
+}
+
+// request describes a single call to the IoT Agent.
+type request struct {
+	// op is the name of the logical operation, see Call.Operation.
+	op     string
+	method string
+	url    string
+	fs     FiwareService
+	// id, resource and apikey identify the device or config group the request is about, if any.
+	id       DeciveId
+	resource Resource
+	apikey   Apikey
+	payload  []byte
+	// status is the status code the IoT Agent answers with on success, 0 for any 2xx.
+	status int
+	// duplicate is the name of the error the IoT Agent answers with if the resource
+	// to create already exists. After a retried create of a single device or config group,
+	// identified by id or resource, it means an earlier attempt succeeded. A bulk create
+	// may have been stored partially, so the error is returned.
+	duplicate ErrorName
+	// header holds additional headers of the request.
+	header http.Header
+	// out is the value the body of a successful response is decoded into, if not nil.
+	// If out is a *[]byte, the body is stored as is.
+	out any
+	// decode, if not nil, is called with the body of a successful response after it was
+	// stored in out. An error is reported as DecodeError.
+	decode func(body []byte) error
+}
+
+// success reports if status is the status code expected on success.
+func (r request) success(status int) bool {
+	if r.status == 0 {
+		return status >= 200 && status < 300
+	}
+	return status == r.status
+}
+
+// headerCorrelator is the header used by FIWARE components to correlate requests.
+const headerCorrelator = "fiware-correlator"
+
+// correlatorKey is the context key of the target set by CaptureCorrelator.
+type correlatorKey struct{}
+
+// CaptureCorrelator returns a context which makes requests sent with it store the
+// fiware-correlator of the response in correlator, e.g. to correlate a successful write
+// with the logs of the IoT Agent. Results of reads expose the correlator directly.
+func CaptureCorrelator(ctx context.Context, correlator *string) context.Context {
+	return context.WithValue(ctx, correlatorKey{}, correlator)
+}
+
+// correlated is implemented by results exposing the fiware-correlator of the response.
+type correlated interface {
+	setCorrelator(correlator string)
+}
+
+// response holds the parts of a http response relevant for decoding.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do passes r through the middleware chain to the IoT Agent and decodes the body of the
+// response into r.out.
+func (i IoTA) do(ctx context.Context, r request) error {
+	call := &Call{
+		Operation:     r.op,
+		FiwareService: r.fs,
+		DeviceId:      r.id,
+		Resource:      r.resource,
+		Apikey:        r.apikey,
+		Method:        r.method,
+		URL:           r.url,
+		Header:        r.header.Clone(),
+		Payload:       r.payload,
+		Response:      r.out,
+	}
+	if call.Header == nil {
+		call.Header = http.Header{}
+	}
+	handler := i.roundTrip(r)
+	// Healthchecks bypass the circuit breaker, they are used to probe the agent while it is open.
+	if i.breaker != nil && r.op != opHealthcheck {
+		handler = i.circuitBreaking(handler)
+	}
+	for idx := len(i.middlewares) - 1; idx >= 0; idx-- {
+		handler = i.middlewares[idx](handler)
+	}
+	if i.metrics != nil {
+		handler = i.observe(handler)
+	}
+	if i.tracer != nil {
+		handler = i.tracing(handler)
+	}
+	return handler(ctx, call)
+}
+
+// roundTrip returns the Handler at the end of the middleware chain which sends the call
+// to the IoT Agent. If the agent does not answer with r.status, the ApiError sent by the
+// agent is returned. Transient failures are retried according to the retry policy.
+func (i IoTA) roundTrip(r request) Handler {
+	return func(ctx context.Context, call *Call) error {
+		start := time.Now()
+		attempt := 1
+		res, err := i.sendAuthenticated(ctx, call)
+		for {
+			wait, retry := i.retryPolicy.next(call.Method, attempt, start, res, err)
+			if !retry {
+				break
+			}
+			i.log(ctx, slog.LevelInfo, "Retrying request to IoT Agent",
+				"operation", call.Operation, "method", call.Method, "url", call.URL, "attempt", attempt+1, "wait", wait)
+			err = sleep(ctx, wait)
+			if err != nil {
+				return err
+			}
+			i.retried(call)
+			attempt++
+			res, err = i.sendAuthenticated(ctx, call)
+		}
+		if err != nil {
+			return err
+		}
+		call.StatusCode = res.status
+		call.Correlator = res.header.Get(headerCorrelator)
+		if target, ok := ctx.Value(correlatorKey{}).(*string); ok && target != nil {
+			*target = call.Correlator
+		}
+
+		if !r.success(res.status) {
+			var apiError ApiError
+			err = json.Unmarshal(res.body, &apiError)
+			if err == nil && apiError.Name == "" {
+				err = errors.New("No IoT Agent error in response")
+			}
+			if err != nil {
+				return newDecodeError(call, res, err)
+			}
+			apiError.StatusCode = res.status
+			apiError.Method = call.Method
+			apiError.URL = call.URL
+			apiError.FiwareService = call.FiwareService
+			apiError.Body = string(res.body)
+			apiError.Correlator = call.Correlator
+			single := r.id != "" || r.resource != ""
+			if attempt > 1 && single && r.duplicate != "" && errors.Is(apiError, r.duplicate) {
+				return nil
+			}
+			return apiError
+		}
+
+		if raw, ok := call.Response.(*[]byte); ok {
+			*raw = res.body
+		} else if call.Response != nil && (r.status != 0 || len(res.body) > 0) {
+			err = json.Unmarshal(res.body, call.Response)
+			if err != nil {
+				return newDecodeError(call, res, err)
+			}
+			if c, ok := call.Response.(correlated); ok {
+				c.setCorrelator(call.Correlator)
+			}
+		}
+		if r.decode != nil {
+			err = r.decode(res.body)
+			if err != nil {
+				return newDecodeError(call, res, err)
+			}
+		}
+		return nil
+	}
+}
+
+// sendAuthenticated sends the call to the IoT Agent. When a TokenProvider is configured and
+// the token is rejected, the token is refreshed and the request is sent once more.
+func (i IoTA) sendAuthenticated(ctx context.Context, call *Call) (*response, error) {
+	res, err := i.send(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+	if res.status == http.StatusUnauthorized && i.tokenProvider != nil {
+		i.tokenProvider.Invalidate(call.FiwareService)
+		return i.send(ctx, call)
+	}
+	return res, nil
+}
+
+// send sends the call once to the IoT Agent and reads the response.
+func (i IoTA) send(ctx context.Context, call *Call) (*response, error) {
+	var body io.Reader
+	if call.Payload != nil {
+		body = bytes.NewReader(call.Payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, call.Method, call.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("Error while creating Request %w", err)
+	}
+	for _, headers := range []http.Header{i.headers, call.Header} {
+		for key, values := range headers {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+	if i.userAgent != "" {
+		req.Header.Set("User-Agent", i.userAgent)
+	}
+	fs := call.FiwareService
+	if fs.Service != "" {
+		req.Header.Set("fiware-service", fs.Service)
+	}
+	if fs.ServicePath != "" {
+		req.Header.Set("fiware-servicepath", fs.ServicePath)
+	}
+	if call.Payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if i.tokenProvider != nil && fs.Service != "" {
+		token, err := i.tokenProvider.Token(ctx, fs)
+		if err != nil {
+			return nil, fmt.Errorf("Error while getting token: %w", err)
+		}
+		req.Header.Set(headerAuthToken, token)
+	}
+	if i.limiter != nil {
+		release, err := i.limiter.acquire(ctx, fs.Service)
+		if err != nil {
+			return nil, fmt.Errorf("Error while waiting for rate limit: %w", err)
+		}
+		defer release()
+	}
+
+	start := time.Now()
+	res, err := i.Client().Do(req)
+	if err != nil {
+		i.log(ctx, slog.LevelDebug, "Request to IoT Agent failed",
+			"operation", call.Operation, "method", call.Method, "url", call.URL,
+			"service", fs.Service, "servicePath", fs.ServicePath,
+			"duration", time.Since(start), "error", err)
+		return nil, fmt.Errorf("Error while requesting resource %w", err)
+	}
+	defer res.Body.Close()
+
+	resData, err := io.ReadAll(res.Body)
+	i.log(ctx, slog.LevelDebug, "Request to IoT Agent",
+		"operation", call.Operation, "method", call.Method, "url", call.URL,
+		"service", fs.Service, "servicePath", fs.ServicePath,
+		"status", res.StatusCode, "correlator", res.Header.Get(headerCorrelator), "duration", time.Since(start))
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading response body %w", err)
+	}
+	return &response{status: res.StatusCode, header: res.Header, body: resData}, nil
+}
@@ -0,0 +1,162 @@
+package iotagentsdk
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how requests failing with a transient error are retried.
+// GET, PUT and DELETE requests are retried, POST requests only if RetryCreates is set.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// A value below 2 disables retries.
+	MaxAttempts int
+	// MaxElapsed is the maximum time spent on all attempts, 0 means no limit.
+	MaxElapsed time.Duration
+	// InitialBackoff is the time to wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time to wait between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the backoff grows by with every retry.
+	Multiplier float64
+	// Jitter randomizes every backoff by up to this fraction, e.g. 0.2 for ±20%.
+	Jitter float64
+	// RetryCreates enables retries of POST requests creating devices or config groups.
+	// If the agent reports a duplicate after a retry of a single create, the create is
+	// considered successful. For bulk creates the duplicate error is returned, as an
+	// earlier attempt may have created only some of them.
+	RetryCreates bool
+	// Retryable decides if a response status or an error is transient.
+	// DefaultRetryable is used if nil.
+	Retryable func(status int, err error) bool
+}
+
+// DefaultRetryPolicy returns the retry policy used by NewIoTAgentWithOptions.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		MaxElapsed:     30 * time.Second,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// DefaultRetryable reports connection errors, 429 Too Many Requests and 5xx responses as transient.
+// Cancelled or expired contexts and failed TLS handshakes are never retried.
+func DefaultRetryable(status int, err error) bool {
+	if err != nil {
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			return false
+		}
+		// TLS alerts sent by the server, e.g. because of a missing client certificate
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "remote error" {
+			return false
+		}
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// WithRetryPolicy sets the retry policy, use RetryPolicy{} to disable retries.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(i *IoTA) error {
+		i.retryPolicy = &p
+		return nil
+	}
+}
+
+// withoutRetries returns a copy of i which sends every request only once.
+func (i IoTA) withoutRetries() IoTA {
+	i.retryPolicy = &RetryPolicy{}
+	return i
+}
+
+// allows reports if requests with the given method may be retried.
+func (p *RetryPolicy) allows(method string) bool {
+	if p == nil || p.MaxAttempts < 2 {
+		return false
+	}
+	return method != http.MethodPost || p.RetryCreates
+}
+
+// backoff returns the time to wait before the given retry, starting at 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// next decides if the request is retried after the given attempt and how long to wait before.
+func (p *RetryPolicy) next(method string, attempt int, start time.Time, res *response, err error) (time.Duration, bool) {
+	if !p.allows(method) || attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	status := 0
+	if res != nil {
+		status = res.status
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+	if !retryable(status, err) {
+		return 0, false
+	}
+
+	wait := p.backoff(attempt)
+	if res != nil {
+		if retryAfter, ok := parseRetryAfter(res.header.Get("Retry-After")); ok && retryAfter > wait {
+			wait = retryAfter
+		}
+	}
+	if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+		return 0, false
+	}
+	return wait, true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either in seconds or as http date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
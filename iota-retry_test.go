@@ -0,0 +1,127 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+// newFlakyServer returns a server answering the first failures requests with 503
+// and all following ones with the given status and body.
+func newFlakyServer(t *testing.T, failures int32, status int, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"name":"SERVICE_UNAVAILABLE","message":"restarting"}`))
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func fastRetryPolicy() i.RetryPolicy {
+	p := i.DefaultRetryPolicy()
+	p.InitialBackoff = time.Millisecond
+	return p
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	srv, calls := newFlakyServer(t, 2, http.StatusOK, `{"count":0,"devices":[]}`)
+	_, err := newTestIoTA(t, srv.URL, i.WithRetryPolicy(fastRetryPolicy())).ListDevices(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls.Load())
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	srv, calls := newFlakyServer(t, 10, http.StatusOK, `{"count":0,"devices":[]}`)
+	_, err := newTestIoTA(t, srv.URL, i.WithRetryPolicy(fastRetryPolicy())).ListDevices(fs)
+	if err == nil {
+		t.Fatal("Expected error after exhausting retries")
+	}
+	if calls.Load() != int32(fastRetryPolicy().MaxAttempts) {
+		t.Errorf("Expected %d calls, got %d", fastRetryPolicy().MaxAttempts, calls.Load())
+	}
+}
+
+func TestRetryCreate(t *testing.T) {
+	duplicate := `{"name":"DUPLICATE_DEVICE_ID","message":"Duplicate device id"}`
+
+	srv, calls := newFlakyServer(t, 1, http.StatusConflict, duplicate)
+	err := newTestIoTA(t, srv.URL, i.WithRetryPolicy(fastRetryPolicy())).CreateDevice(fs, d)
+	if err == nil {
+		t.Error("Expected POST not to be retried by default")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 call, got %d", calls.Load())
+	}
+
+	p := fastRetryPolicy()
+	p.RetryCreates = true
+	srv, calls = newFlakyServer(t, 1, http.StatusConflict, duplicate)
+	err = newTestIoTA(t, srv.URL, i.WithRetryPolicy(p)).CreateDevice(fs, d)
+	if err != nil {
+		t.Errorf("Expected duplicate after retry to count as success, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls.Load())
+	}
+
+	srv, _ = newFlakyServer(t, 0, http.StatusConflict, duplicate)
+	err = newTestIoTA(t, srv.URL, i.WithRetryPolicy(p)).CreateDevice(fs, d)
+	if err == nil {
+		t.Error("Expected duplicate without retry to be an error")
+	}
+
+	// A bulk create may have been stored partially before the failure
+	d2 := d
+	d2.Id = "test_device_2"
+	srv, calls = newFlakyServer(t, 1, http.StatusConflict, duplicate)
+	err = newTestIoTA(t, srv.URL, i.WithRetryPolicy(p)).CreateDevices(fs, []i.Device{d, d2})
+	if !errors.Is(err, i.ErrDuplicateDeviceID) || calls.Load() != 2 {
+		t.Errorf("Expected duplicate of bulk create after retry to be an error, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	srv, _ := newFlakyServer(t, 10, http.StatusOK, `{}`)
+	p := i.DefaultRetryPolicy()
+	p.InitialBackoff = time.Hour
+	p.MaxBackoff = time.Hour
+	p.MaxElapsed = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := newTestIoTA(t, srv.URL, i.WithRetryPolicy(p)).ListDevicesCtx(ctx, fs)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestNewIoTAgentRetries(t *testing.T) {
+	srv, calls := newFlakyServer(t, 1, http.StatusOK, `{"count":0,"devices":[]}`)
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	portNumber, _ := strconv.Atoi(port)
+	_, err := i.NewIoTAgent(host, portNumber, 1000).ListDevices(fs)
+	if err != nil || calls.Load() != 2 {
+		t.Errorf("Expected GET to be retried by default, got %v after %d calls", err, calls.Load())
+	}
+}
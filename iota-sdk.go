@@ -2,23 +2,22 @@
 package iotagentsdk
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
-	"os"
 	"slices"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
-	log "github.com/rs/zerolog/log"
 )
 
-// Constants for the IoT Agent URL and Healthcheck URL.
+// Constants for the default scheme and Healthcheck URL.
 const (
-	urlBase        = "http://%v:%d"
-	urlHealthcheck = urlBase + "/iot/about"
+	defaultScheme  = "http"
+	urlHealthcheck = "/iot/about"
+	opHealthcheck  = "Healthcheck"
 )
 
 // Error returns the error as a formatted string.
@@ -26,29 +25,26 @@ func (e ApiError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Name, e.Message)
 }
 
-// init initializes the logging level based on the "LOG_LEVEL" environment variable.
-// By default, "panic" is used if no environment variable is set.
-func init() {
-	logLvl := os.Getenv("LOG_LEVEL")
-	if logLvl == "" {
-		logLvl = "panic"
-	}
-	SetLogLevel(logLvl)
-}
-
 // NewIoTAgent creates a new instance of the IoT Agent.
+// Requests are retried according to DefaultRetryPolicy.
 func NewIoTAgent(host string, port int, timeout_ms int) *IoTA {
+	retryPolicy := DefaultRetryPolicy()
 	iota := IoTA{
-		Host:       host,
-		Port:       port,
-		timeout_ms: time.Duration(timeout_ms) * time.Millisecond,
-		client:     &http.Client{Timeout: time.Duration(timeout_ms) * time.Millisecond},
+		Host:        host,
+		Port:        port,
+		timeout_ms:  time.Duration(timeout_ms) * time.Millisecond,
+		client:      &http.Client{Timeout: time.Duration(timeout_ms) * time.Millisecond},
+		retryPolicy: &retryPolicy,
 	}
 	return &iota
 }
 
-// SetLogLevel sets the global logging level based on the given value.
+// SetLogLevel sets the global zerolog logging level based on the given value.
 // Possible values are: "trace", "debug", "info", "warning", "error", "fatal", "panic".
+// Unknown values are ignored.
+//
+// Deprecated: The SDK no longer logs via the global zerolog logger, so this has no effect
+// on the SDK. Use WithLogger to configure logging per IoTA.
 func SetLogLevel(ll string) {
 	ll = strings.ToLower(ll)
 	switch ll {
@@ -66,45 +62,59 @@ func SetLogLevel(ll string) {
 		zerolog.SetGlobalLevel(zerolog.FatalLevel)
 	case "panic":
 		zerolog.SetGlobalLevel(zerolog.PanicLevel)
-	default:
-		log.Fatal().Msg("Log level need to be one of this: [TRACE DEBUG INFO WARNING ERROR FATAL PANIC]")
 	}
 }
 
+func (r *RespHealthcheck) setCorrelator(correlator string) { r.Correlator = correlator }
+
 // Healthcheck performs a health check of the IoT Agent and returns the result.
+// An error is returned if the agent does not answer or reports no version at all,
+// incomplete or invalid information is reported as HealthDegraded.
 func (i IoTA) Healthcheck() (*RespHealthcheck, error) {
-	response, err := http.Get(fmt.Sprintf(urlHealthcheck, i.Host, i.Port))
-	if err != nil {
-		return nil, fmt.Errorf("Error while Healthcheck: %w", err)
-	}
-	defer response.Body.Close()
+	return i.HealthcheckCtx(context.Background())
+}
 
-	responseData, err := io.ReadAll(response.Body)
+// HealthcheckCtx is like Healthcheck but uses the given context for the request.
+// Healthchecks are not subject to the circuit breaker.
+func (i IoTA) HealthcheckCtx(ctx context.Context) (*RespHealthcheck, error) {
+	var respHealth RespHealthcheck
+	err := i.do(ctx, request{
+		op:     opHealthcheck,
+		method: http.MethodGet,
+		url:    i.url(urlHealthcheck),
+		status: http.StatusOK,
+		out:    &respHealth,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Error while Healthcheck: %w", err)
 	}
-	var respHealth RespHealthcheck
-	json.Unmarshal(responseData, &respHealth)
-	if respHealth.LibVersion == "" {
+	if respHealth.LibVersion == "" && respHealth.Version == "" {
 		return nil, fmt.Errorf("Error healtchecking IoT-Agent, host: %s", i.Host)
 	}
-	log.Debug().Str("Response healthcheck", string(responseData)).Any("Healthcheck", respHealth).Send()
+	respHealth.assess()
+	level := slog.LevelDebug
+	if respHealth.Status == HealthDegraded {
+		level = slog.LevelWarn
+	}
+	i.log(ctx, level, "Healthcheck", "host", i.Host, "healthcheck", respHealth)
 	return &respHealth, nil
 }
 
-// GetAllServicePathsForService returns all service paths for the specified service.
+// GetAllServicePathsForService returns all service paths for the specified service,
+// walking all pages of config groups. Use DiscoverServicePaths to include service paths
+// which only contain devices.
 func (i IoTA) GetAllServicePathsForService(service string) ([]string, error) {
-	cgs, err := i.ListConfigGroups(FiwareService{service, "/*"})
-	if err != nil {
-		return nil, err
-	}
-
-	if cgs.Count == 0 {
-		return nil, nil
-	}
+	return i.GetAllServicePathsForServiceCtx(context.Background(), service)
+}
 
-	servicePaths := []string{}
-	for _, cg := range cgs.Services {
+// GetAllServicePathsForServiceCtx is like GetAllServicePathsForService but uses
+// the given context for the request.
+func (i IoTA) GetAllServicePathsForServiceCtx(ctx context.Context, service string) ([]string, error) {
+	var servicePaths []string
+	for cg, err := range i.AllConfigGroups(ctx, FiwareService{service, "/*"}, ListOptions{}) {
+		if err != nil {
+			return nil, err
+		}
 		if !slices.Contains(servicePaths, cg.ServicePath) {
 			servicePaths = append(servicePaths, cg.ServicePath)
 		}
@@ -117,7 +127,6 @@ func (i IoTA) GetAllServicePathsForService(service string) ([]string, error) {
 // If no client is present, a new one is created.
 func (i IoTA) Client() *http.Client {
 	if i.client == nil {
-		log.Debug().Msg("Creating http client")
 		i.client = &http.Client{Timeout: i.timeout_ms}
 	}
 	return i.client
@@ -0,0 +1,237 @@
+package iotagentsdk
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader loads a client certificate from files and reloads it whenever one of the files changes,
+// so rotated certificates are picked up without rebuilding the client.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// newCertReloader creates a certReloader and loads the certificate once.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	err := cr.reload()
+	if err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// stat returns the modification times of the certificate and key file.
+func (cr *certReloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for idx, file := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, fmt.Errorf("Error while reading certificate: %w", err)
+		}
+		modTimes[idx] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// reload loads the certificate from the files.
+func (cr *certReloader) reload() error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.reloadLocked()
+}
+
+// reloadLocked is like reload but expects cr.mu to be held.
+func (cr *certReloader) reloadLocked() error {
+	modTimes, err := cr.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("Error while loading client certificate: %w", err)
+	}
+	cr.cert = &cert
+	cr.modTimes = modTimes
+	return nil
+}
+
+// getClientCertificate returns the current certificate, reloading it if the files changed.
+// If reloading fails, the previously loaded certificate is used.
+func (cr *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	modTimes, err := cr.stat()
+	if err == nil && modTimes != cr.modTimes {
+		cr.reloadLocked()
+	}
+	return cr.cert, nil
+}
+
+// tlsConfigOrNew returns the tls config of i, creating it if needed.
+func (i *IoTA) tlsConfigOrNew() *tls.Config {
+	if i.tlsConfig == nil {
+		i.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return i.tlsConfig
+}
+
+// rootCAsOrNew returns the root CAs of the tls config of i, creating an empty pool if needed.
+func (i *IoTA) rootCAsOrNew() *x509.CertPool {
+	cfg := i.tlsConfigOrNew()
+	if cfg.RootCAs == nil {
+		cfg.RootCAs = x509.NewCertPool()
+	}
+	return cfg.RootCAs
+}
+
+// tlsTransport returns a transport using the tls config of i, based on the configured transport or client.
+func (i IoTA) tlsTransport() (http.RoundTripper, error) {
+	base := i.transport
+	if base == nil && i.client != nil {
+		base = i.client.Transport
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, errors.New("TLS options require the transport to be a *http.Transport")
+	}
+	transport = transport.Clone()
+	transport.TLSClientConfig = i.tlsConfig
+	return transport, nil
+}
+
+// WithTLSConfig sets the tls config used to connect to the IoT Agent.
+// The config is cloned; other TLS options are applied on top of it. Root CAs, client
+// certificates and the server name set by earlier TLS options are kept, it is an error
+// if cfg sets them as well.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(i *IoTA) error {
+		if cfg == nil {
+			return errors.New("TLS config cannot be nil")
+		}
+		merged := cfg.Clone()
+		// CA options append to the pool, which must not change the pool of the caller
+		if merged.RootCAs != nil {
+			merged.RootCAs = merged.RootCAs.Clone()
+		}
+		if i.tlsConfig != nil {
+			err := mergeTLSConfig(merged, i.tlsConfig)
+			if err != nil {
+				return err
+			}
+		}
+		i.tlsConfig = merged
+		return nil
+	}
+}
+
+// mergeTLSConfig takes the settings of earlier TLS options from prev into cfg.
+func mergeTLSConfig(cfg, prev *tls.Config) error {
+	if prev.RootCAs != nil {
+		if cfg.RootCAs != nil {
+			return errors.New("TLS config sets root CAs already set by an earlier option")
+		}
+		cfg.RootCAs = prev.RootCAs
+	}
+	if len(prev.Certificates) > 0 || prev.GetClientCertificate != nil {
+		if len(cfg.Certificates) > 0 || cfg.GetClientCertificate != nil {
+			return errors.New("TLS config sets a client certificate already set by an earlier option")
+		}
+		cfg.Certificates = prev.Certificates
+		cfg.GetClientCertificate = prev.GetClientCertificate
+	}
+	if prev.ServerName != "" {
+		if cfg.ServerName != "" && cfg.ServerName != prev.ServerName {
+			return errors.New("TLS config sets a server name already set by an earlier option")
+		}
+		cfg.ServerName = prev.ServerName
+	}
+	return nil
+}
+
+// WithCACertFile adds the PEM encoded CA certificates in file to the trusted root CAs.
+// Once a CA is added, the system root CAs are no longer trusted.
+func WithCACertFile(file string) Option {
+	return func(i *IoTA) error {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("Error while reading CA certificate: %w", err)
+		}
+		return WithCACertPEM(pem)(i)
+	}
+}
+
+// WithCACertPEM adds the PEM encoded CA certificates to the trusted root CAs.
+// Once a CA is added, the system root CAs are no longer trusted.
+func WithCACertPEM(pem []byte) Option {
+	return func(i *IoTA) error {
+		if !i.rootCAsOrNew().AppendCertsFromPEM(pem) {
+			return errors.New("No valid CA certificate found")
+		}
+		return nil
+	}
+}
+
+// WithClientCertFile sets the client certificate and key used for mutual TLS.
+// The files are watched and the certificate is reloaded when they change,
+// e.g. on rotation. See also IoTA.ReloadTLSCertificates.
+func WithClientCertFile(certFile, keyFile string) Option {
+	return func(i *IoTA) error {
+		cr, err := newCertReloader(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		i.certReloader = cr
+		cfg := i.tlsConfigOrNew()
+		cfg.Certificates = nil
+		cfg.GetClientCertificate = cr.getClientCertificate
+		return nil
+	}
+}
+
+// WithClientCertPEM sets the PEM encoded client certificate and key used for mutual TLS.
+func WithClientCertPEM(certPEM, keyPEM []byte) Option {
+	return func(i *IoTA) error {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return fmt.Errorf("Error while loading client certificate: %w", err)
+		}
+		i.certReloader = nil
+		cfg := i.tlsConfigOrNew()
+		cfg.GetClientCertificate = nil
+		cfg.Certificates = []tls.Certificate{cert}
+		return nil
+	}
+}
+
+// WithServerName sets the server name used to verify the certificate of the IoT Agent.
+func WithServerName(serverName string) Option {
+	return func(i *IoTA) error {
+		i.tlsConfigOrNew().ServerName = serverName
+		return nil
+	}
+}
+
+// ReloadTLSCertificates reloads the client certificate set with WithClientCertFile.
+// Certificates are reloaded automatically when the files change, this forces a reload.
+// New certificates are used for new connections only.
+func (i IoTA) ReloadTLSCertificates() error {
+	if i.certReloader == nil {
+		return errors.New("No client certificate files configured")
+	}
+	return i.certReloader.reload()
+}
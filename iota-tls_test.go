@@ -0,0 +1,225 @@
+package iotagentsdk_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+)
+
+// newClientCert creates a self signed client certificate with the given common name
+// and returns the certificate and key PEM encoded.
+func newClientCert(t *testing.T, cn string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// newMTLSServer starts a TLS server which requires one of the given client certificates
+// and reports the common name of the client certificate used.
+func newMTLSServer(t *testing.T, clientCerts ...[]byte) (*httptest.Server, *string) {
+	t.Helper()
+	var cn string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cn = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.Write([]byte(`{"libVersion":"4.0.0","port":"4041","baseRoot":"/","version":"1.0.0"}`))
+	}))
+	pool := x509.NewCertPool()
+	for _, c := range clientCerts {
+		pool.AppendCertsFromPEM(c)
+	}
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, &cn
+}
+
+func serverCAPEM(srv *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+}
+
+func TestTLSClientCertPEM(t *testing.T) {
+	certPEM, keyPEM := newClientCert(t, "client")
+	srv, cn := newMTLSServer(t, certPEM)
+
+	iotaTLS := newTestIoTA(t, srv.URL,
+		i.WithCACertPEM(serverCAPEM(srv)),
+		i.WithClientCertPEM(certPEM, keyPEM),
+	)
+	_, err := iotaTLS.Healthcheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *cn != "client" {
+		t.Errorf("Unexpected client certificate %s", *cn)
+	}
+
+	iotaNoCert := newTestIoTA(t, srv.URL, i.WithCACertPEM(serverCAPEM(srv)))
+	_, err = iotaNoCert.Healthcheck()
+	if err == nil {
+		t.Error("Expected handshake to fail without client certificate")
+	}
+}
+
+func TestTLSClientCertFileRotation(t *testing.T) {
+	oldCert, oldKey := newClientCert(t, "old")
+	newCert, newKey := newClientCert(t, "new")
+	srv, cn := newMTLSServer(t, oldCert, newCert)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	writeFile := func(name string, data []byte, modTime time.Time) {
+		if err := os.WriteFile(name, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	writeFile(caFile, serverCAPEM(srv), now)
+	writeFile(certFile, oldCert, now)
+	writeFile(keyFile, oldKey, now)
+
+	iotaTLS := newTestIoTA(t, srv.URL,
+		i.WithCACertFile(caFile),
+		i.WithClientCertFile(certFile, keyFile),
+	)
+	_, err := iotaTLS.Healthcheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *cn != "old" {
+		t.Errorf("Unexpected client certificate %s", *cn)
+	}
+
+	later := now.Add(time.Minute)
+	writeFile(certFile, newCert, later)
+	writeFile(keyFile, newKey, later)
+	iotaTLS.Client().CloseIdleConnections()
+
+	_, err = iotaTLS.Healthcheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *cn != "new" {
+		t.Errorf("Expected rotated client certificate, got %s", *cn)
+	}
+	if err := iotaTLS.ReloadTLSCertificates(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTLSConfigOptionOrder(t *testing.T) {
+	certPEM, keyPEM := newClientCert(t, "client")
+	srv, cn := newMTLSServer(t, certPEM)
+
+	orders := map[string][]i.Option{
+		"config first": {
+			i.WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}),
+			i.WithCACertPEM(serverCAPEM(srv)),
+			i.WithClientCertPEM(certPEM, keyPEM),
+		},
+		"config last": {
+			i.WithCACertPEM(serverCAPEM(srv)),
+			i.WithClientCertPEM(certPEM, keyPEM),
+			i.WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}),
+		},
+	}
+	for name, opts := range orders {
+		t.Run(name, func(t *testing.T) {
+			*cn = ""
+			iotaTLS := newTestIoTA(t, srv.URL, opts...)
+			_, err := iotaTLS.Healthcheck()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *cn != "client" {
+				t.Errorf("Unexpected client certificate %s", *cn)
+			}
+		})
+	}
+
+	_, err := i.NewIoTAgentWithOptions("", 0,
+		i.WithBaseURL(srv.URL),
+		i.WithCACertPEM(serverCAPEM(srv)),
+		i.WithTLSConfig(&tls.Config{RootCAs: x509.NewCertPool()}),
+	)
+	if err == nil {
+		t.Error("Expected error for root CAs set twice")
+	}
+}
+
+func TestTLSOptionsScheme(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"libVersion":"4.0.0","port":"4041","baseRoot":"/","version":"1.0.0"}`))
+	}))
+	defer srv.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "https://"))
+	portNumber, _ := strconv.Atoi(port)
+
+	// TLS options switch the default scheme to https
+	iotaTLS, err := i.NewIoTAgentWithOptions(host, portNumber, i.WithCACertPEM(serverCAPEM(srv)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = iotaTLS.Healthcheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = i.NewIoTAgentWithOptions(host, portNumber, i.WithScheme("http"), i.WithServerName("iota"))
+	if err == nil {
+		t.Error("Expected error for TLS options with http scheme")
+	}
+}
+
+func TestTLSConfigRootCAsNotShared(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	newTestIoTA(t, srv.URL, i.WithTLSConfig(&tls.Config{RootCAs: pool}), i.WithCACertPEM(serverCAPEM(srv)))
+	if !pool.Equal(x509.NewCertPool()) {
+		t.Error("Expected the root CAs of the caller to be unchanged")
+	}
+}
@@ -0,0 +1,127 @@
+package iotagentsdk
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// ServicePathNode is a node of the service path tree of a fiware-service.
+type ServicePathNode struct {
+	// Path is the full service path, / for the root.
+	Path string
+	// Name is the last segment of Path, empty for the root.
+	Name string
+	// ConfigGroups and Devices are the number of config groups and devices in this service path,
+	// not including its children.
+	ConfigGroups int
+	Devices      int
+	// Children are the nodes below this one, sorted by name.
+	Children []*ServicePathNode
+}
+
+// Find returns the node of the service path, nil if there is none.
+func (n *ServicePathNode) Find(servicePath string) *ServicePathNode {
+	node := n
+	for _, name := range splitServicePath(servicePath) {
+		idx, found := node.child(name)
+		if !found {
+			return nil
+		}
+		node = node.Children[idx]
+	}
+	return node
+}
+
+// Walk calls fn for the node and all nodes below it, parents before their children.
+// Walk stops descending into a node if fn returns false.
+func (n *ServicePathNode) Walk(fn func(*ServicePathNode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
+
+// Paths returns the service paths of the node and all nodes below it in depth-first order.
+func (n *ServicePathNode) Paths() []string {
+	var paths []string
+	n.Walk(func(node *ServicePathNode) bool {
+		paths = append(paths, node.Path)
+		return true
+	})
+	return paths
+}
+
+// TotalConfigGroups returns the number of config groups in this node and all nodes below it.
+func (n *ServicePathNode) TotalConfigGroups() int {
+	total := 0
+	n.Walk(func(node *ServicePathNode) bool {
+		total += node.ConfigGroups
+		return true
+	})
+	return total
+}
+
+// TotalDevices returns the number of devices in this node and all nodes below it.
+func (n *ServicePathNode) TotalDevices() int {
+	total := 0
+	n.Walk(func(node *ServicePathNode) bool {
+		total += node.Devices
+		return true
+	})
+	return total
+}
+
+// child returns the index of the child with the given name, or where it would be inserted.
+func (n *ServicePathNode) child(name string) (int, bool) {
+	return slices.BinarySearchFunc(n.Children, name, func(c *ServicePathNode, name string) int {
+		return strings.Compare(c.Name, name)
+	})
+}
+
+// node returns the node of the service path, creating it and its parents if needed.
+func (n *ServicePathNode) node(servicePath string) *ServicePathNode {
+	node := n
+	for _, name := range splitServicePath(servicePath) {
+		idx, found := node.child(name)
+		if !found {
+			child := &ServicePathNode{Path: strings.TrimSuffix(node.Path, "/") + "/" + name, Name: name}
+			node.Children = slices.Insert(node.Children, idx, child)
+		}
+		node = node.Children[idx]
+	}
+	return node
+}
+
+// splitServicePath returns the segments of a service path, none for the root.
+func splitServicePath(servicePath string) []string {
+	var names []string
+	for _, name := range strings.Split(servicePath, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// DiscoverServicePaths returns the tree of all service paths of the service which contain
+// config groups or devices, walking all pages of both. The root is the service path /.
+func (i IoTA) DiscoverServicePaths(ctx context.Context, service string) (*ServicePathNode, error) {
+	root := &ServicePathNode{Path: "/"}
+	fs := FiwareService{service, "/*"}
+	for cg, err := range i.AllConfigGroups(ctx, fs, ListOptions{}) {
+		if err != nil {
+			return nil, err
+		}
+		root.node(cg.ServicePath).ConfigGroups++
+	}
+	for d, err := range i.AllDevices(ctx, fs, ListOptions{}) {
+		if err != nil {
+			return nil, err
+		}
+		root.node(d.ServicePath).Devices++
+	}
+	return root, nil
+}
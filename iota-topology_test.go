@@ -0,0 +1,55 @@
+package iotagentsdk_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestDiscoverServicePaths(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("fiware-servicepath") != "/*" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"name":"BAD_REQUEST","message":"expected /*"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/iot/services":
+			w.Write([]byte(`{"count":3,"services":[
+				{"resource":"/iot/d","apikey":"a","subservice":"/a"},
+				{"resource":"/iot/d","apikey":"b","subservice":"/a"},
+				{"resource":"/iot/d","apikey":"c","subservice":"/c/d"}]}`))
+		case "/iot/devices":
+			w.Write([]byte(`{"count":3,"devices":[
+				{"device_id":"1","service_path":"/a/b"},
+				{"device_id":"2","service_path":"/"},
+				{"device_id":"3","service_path":"/a"}]}`))
+		}
+	}))
+	defer srv.Close()
+	iotaTopo := newTestIoTA(t, srv.URL)
+
+	root, err := iotaTopo.DiscoverServicePaths(context.Background(), service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/", "/a", "/a/b", "/c", "/c/d"}
+	if paths := root.Paths(); !slices.Equal(paths, expected) {
+		t.Errorf("Expected paths %v, got %v", expected, paths)
+	}
+	if root.Devices != 1 || root.TotalDevices() != 3 || root.TotalConfigGroups() != 3 {
+		t.Errorf("Unexpected counts %+v", root)
+	}
+	a := root.Find("/a")
+	if a == nil || a.Name != "a" || a.ConfigGroups != 2 || a.Devices != 1 {
+		t.Errorf("Unexpected node /a %+v", a)
+	}
+	if c := root.Find("/c"); c == nil || c.ConfigGroups != 0 || c.TotalConfigGroups() != 1 {
+		t.Errorf("Unexpected node /c %+v", c)
+	}
+	if root.Find("/x") != nil {
+		t.Error("Expected no node for /x")
+	}
+}
@@ -0,0 +1,70 @@
+package iotagentsdk
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the OpenTelemetry tracer of the SDK.
+const tracerName = "github.com/fbuedding/fiware-iot-agent-sdk"
+
+// WithTracerProvider enables OpenTelemetry tracing with a span per IoTA operation.
+// The W3C trace context is sent with every request and the trace id is used as fiware-correlator,
+// so the logs of the IoT Agent can be correlated with the trace.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(i *IoTA) error {
+		if tp == nil {
+			return errors.New("Tracer provider cannot be nil")
+		}
+		i.tracer = tp.Tracer(tracerName)
+		return nil
+	}
+}
+
+// tracing returns a Middleware creating a span for every call.
+func (i IoTA) tracing(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		attrs := []attribute.KeyValue{
+			attribute.String("iota.operation", call.Operation),
+			attribute.String("fiware.service", call.FiwareService.Service),
+			attribute.String("fiware.servicepath", call.FiwareService.ServicePath),
+			attribute.String("http.request.method", call.Method),
+			attribute.String("url.full", call.URL),
+		}
+		if call.DeviceId != "" {
+			attrs = append(attrs, attribute.String("iota.device_id", string(call.DeviceId)))
+		}
+		if call.Resource != "" {
+			attrs = append(attrs, attribute.String("iota.resource", string(call.Resource)))
+		}
+		if call.Apikey != "" {
+			attrs = append(attrs, attribute.String("iota.apikey", string(call.Apikey)))
+		}
+		ctx, span := i.tracer.Start(ctx, "IoTA "+call.Operation,
+			trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(call.Header))
+		if sc := span.SpanContext(); sc.HasTraceID() && call.Header.Get(headerCorrelator) == "" {
+			call.Header.Set(headerCorrelator, sc.TraceID().String())
+		}
+
+		err := next(ctx, call)
+		if call.StatusCode != 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", call.StatusCode))
+		}
+		if call.Correlator != "" {
+			span.SetAttributes(attribute.String("fiware.correlator", call.Correlator))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
@@ -0,0 +1,83 @@
+package iotagentsdk_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	i "github.com/fbuedding/fiware-iot-agent-sdk"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	var gotCorrelator, gotTraceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotCorrelator = r.Header.Get("fiware-correlator")
+		gotTraceparent = r.Header.Get("traceparent")
+		w.Header().Set("fiware-correlator", gotCorrelator)
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"name":"DEVICE_NOT_FOUND","message":"No device was found"}`))
+			return
+		}
+		w.Write([]byte(`{"count":0,"services":[]}`))
+	}))
+	defer srv.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	iotaTrace := newTestIoTA(t, srv.URL, i.WithTracerProvider(tp))
+
+	cgs, err := iotaTrace.ReadConfigGroup(fs, resource, apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	traceID := span.SpanContext.TraceID().String()
+	if span.Name != "IoTA ReadConfigGroup" {
+		t.Errorf("Unexpected span name %s", span.Name)
+	}
+	if gotCorrelator != traceID || cgs.Correlator != traceID {
+		t.Errorf("Expected correlator %s, sent %s, got %s", traceID, gotCorrelator, cgs.Correlator)
+	}
+	if gotTraceparent == "" {
+		t.Error("Expected traceparent header")
+	}
+	if spanAttr(span, "fiware.service").AsString() != service ||
+		spanAttr(span, "iota.resource").AsString() != string(resource) ||
+		spanAttr(span, "iota.apikey").AsString() != apiKey ||
+		spanAttr(span, "http.response.status_code").AsInt64() != http.StatusOK {
+		t.Errorf("Unexpected span attributes %v", span.Attributes)
+	}
+
+	exporter.Reset()
+	err = iotaTrace.DeleteDevice(fs, deviceId)
+	var apiError i.ApiError
+	if !errors.As(err, &apiError) {
+		t.Fatalf("Expected ApiError, got %v", err)
+	}
+	span = exporter.GetSpans()[0]
+	if apiError.Correlator != span.SpanContext.TraceID().String() {
+		t.Errorf("Expected correlator on error, got %s", apiError.Correlator)
+	}
+	if span.Status.Code != codes.Error || spanAttr(span, "iota.device_id").AsString() != string(deviceId) {
+		t.Errorf("Unexpected span %+v", span)
+	}
+}
@@ -1,6 +1,7 @@
 package iotagentsdk
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,14 +10,30 @@ import (
 	"time"
 
 	"github.com/niemeyer/golang/src/pkg/container/vector"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // IoTA represents an IoT Agent instance.
 type IoTA struct {
-	Host       string
-	Port       int
-	timeout_ms time.Duration
-	client     *http.Client
+	Host          string
+	Port          int
+	timeout_ms    time.Duration
+	client        *http.Client
+	scheme        string
+	basePath      string
+	transport     http.RoundTripper
+	headers       http.Header
+	userAgent     string
+	tlsConfig     *tls.Config
+	certReloader  *certReloader
+	tokenProvider TokenProvider
+	retryPolicy   *RetryPolicy
+	logger        Logger
+	middlewares   []Middleware
+	tracer        trace.Tracer
+	metrics       *MetricsCollector
+	breaker       *breaker
+	limiter       *limiter
 }
 
 // FiwareService represents a Fiware service and its associated service path.
@@ -31,12 +48,27 @@ type RespHealthcheck struct {
 	Port       string `json:"port"`
 	BaseRoot   string `json:"baseRoot"`
 	Version    string `json:"version"`
+	// Status is HealthDegraded if the agent reported incomplete or invalid information.
+	Status HealthStatus `json:"-"`
+	// Issues describes why the agent is degraded.
+	Issues []string `json:"-"`
+	// Correlator is the fiware-correlator of the response.
+	Correlator string `json:"-"`
 }
 
 // ApiError represents an error in an API call.
+// Name and Message are reported by the IoT Agent, the other fields describe the failed request.
 type ApiError struct {
-	Name    string `json:"name"`
-	Message string `json:"message"`
+	Name          string        `json:"name"`
+	Message       string        `json:"message"`
+	StatusCode    int           `json:"-"`
+	Method        string        `json:"-"`
+	URL           string        `json:"-"`
+	FiwareService FiwareService `json:"-"`
+	// Body is the raw body of the response.
+	Body string `json:"-"`
+	// Correlator is the fiware-correlator of the response.
+	Correlator string `json:"-"`
 }
 
 // Attribute represents an attribute in the data model.
@@ -49,6 +81,8 @@ type Attribute struct {
 	EntityName string              `json:"entity_name,omitempty" form:"entity_name"`
 	EntityType string              `json:"entity_type,omitempty" form:"entity_type"`
 	Metadata   map[string]Metadata `json:"metadata,omitempty" form:"metadata"`
+	// Extra holds the JSON members not modeled by the SDK.
+	Extra Extra `json:"-" form:"-"`
 }
 
 // LazyAttribute represents a lazy attribute in the data model.
@@ -57,6 +91,8 @@ type LazyAttribute struct {
 	Name     string              `json:"name" form:"name"`
 	Type     string              `json:"type" form:"type"`
 	Metadata map[string]Metadata `json:"metadata,omitempty" form:"metadata"`
+	// Extra holds the JSON members not modeled by the SDK.
+	Extra Extra `json:"-" form:"-"`
 }
 
 // StaticAttribute represents a static attribute in the data model.
@@ -66,6 +102,8 @@ type StaticAttribute struct {
 	Type     string              `json:"type" form:"type"`
 	Value    any                 `json:"value" form:"value"`
 	Metadata map[string]Metadata `json:"metadata,omitempty" form:"metadata"`
+	// Extra holds the JSON members not modeled by the SDK.
+	Extra Extra `json:"-" form:"-"`
 }
 
 // Command represents a command in the data model.
@@ -77,6 +115,8 @@ type Command struct {
 	PayloadType string              `json:"payloadType,omitempty" form:"payloadType"`
 	ContentType string              `json:"contentType,omitempty" form:"contentType"`
 	Metadata    map[string]Metadata `json:"metadata,omitempty" form:"metadata"`
+	// Extra holds the JSON members not modeled by the SDK.
+	Extra Extra `json:"-" form:"-"`
 }
 
 // Metadata represents metadata for attributes and commands.
@@ -92,6 +132,7 @@ type Apikey string
 type Resource string
 
 // ConfigGroup represents a configuration group.
+// Fields added after iotagent-node-lib 2.x are tagged with the version introducing them.
 // See datamodel [Config Group]: https://iotagent-node-lib.readthedocs.io/en/latest/api.html#service-group-datamodel
 type ConfigGroup struct {
 	Service                      string            `json:"service,omitempty" form:"service"`
@@ -109,26 +150,34 @@ type ConfigGroup struct {
 	InternalAttributes           []interface{}     `json:"internal_attributes,omitempty" form:"internal_attributes"`
 	ExplicitAttrs                string            `json:"explicitAttrs,omitempty" form:"explicitAttrs"`
 	EntityNameExp                string            `json:"entityNameExp,omitempty" form:"entityNameExp"`
-	NgsiVersion                  string            `json:"ngsiVersion,omitempty" form:"ngsiVersion"`
+	NgsiVersion                  NgsiVersion       `json:"ngsiVersion,omitempty" form:"ngsiVersion"`
+	JsonLdContext                string            `json:"jsonLdContext,omitempty" form:"jsonLdContext"`
 	DefaultEntityNameConjunction string            `json:"defaultEntityNameConjunction,omitempty" form:"defaultEntityNameConjunction"`
 	Autoprovision                bool              `json:"autoprovision,omitempty" form:"autoprovision"`
 	PayloadType                  string            `json:"payloadType,omitempty" form:"payloadType"`
 	Transport                    string            `json:"transport,omitempty" form:"transport"`
 	Endpoint                     string            `json:"endpoint,omitempty" form:"endpoint"`
+	StoreLastMeasure             *bool             `json:"storeLastMeasure,omitempty" form:"storeLastMeasure" since:"3.2.0"`
+	UseCBflowControl             *bool             `json:"useCBflowControl,omitempty" form:"useCBflowControl" since:"3.0.0"`
+	// Deprecated: ExpressionLanguage was removed in iotagent-node-lib 4.0.0, jexl is the only language.
+	ExpressionLanguage string `json:"expressionLanguage,omitempty" form:"expressionLanguage"`
+	// Extra holds the JSON members not modeled by the SDK.
+	Extra Extra `json:"-" form:"-"`
 }
 
 // DeciveId represents a device ID.
 type DeciveId string
 
 // Device represents a device.
-// See datamodel [Device]: https://iotagent-node-lib.readthedocs.io/en/3.3.0/api.html#device-datamodel
+// Fields added after iotagent-node-lib 2.x are tagged with the version introducing them.
+// See datamodel [Device]: https://iotagent-node-lib.readthedocs.io/en/latest/api.html#device-datamodel
 type Device struct {
 	Id                 DeciveId          `json:"device_id,omitempty" form:"device_id"`
 	Service            string            `json:"service,omitempty" form:"service"`
 	ServicePath        string            `json:"service_path,omitempty" form:"service_path"`
 	EntityName         string            `json:"entity_name,omitempty" form:"entity_name"`
 	EntityType         string            `json:"entity_type,omitempty" form:"entity_type"`
-	Timezone           string            `json:"timezon,omitempty" form:"timezone"`
+	Timezone           string            `json:"timezone,omitempty" form:"timezone"`
 	Timestamp          *bool             `json:"timestamp,omitempty" form:"timestamp"`
 	Apikey             Apikey            `json:"apikey,omitempty" form:"apikey"`
 	Endpoint           string            `json:"endpoint,omitempty" form:"endpoint"`
@@ -140,11 +189,36 @@ type Device struct {
 	StaticAttributes   []StaticAttribute `json:"static_attributes,omitempty" form:"static_attributes"`
 	InternalAttributes []interface{}     `json:"internal_attributes,omitempty" form:"internal_attributes"`
 	ExplicitAttrs      any               `json:"explicitAttrs,omitempty" form:"explicitAttrs"`
-	NgsiVersion        string            `json:"ngsiVersion,omitempty" form:"ngsiVersion"`
+	NgsiVersion        NgsiVersion       `json:"ngsiVersion,omitempty" form:"ngsiVersion"`
+	JsonLdContext      string            `json:"jsonLdContext,omitempty" form:"jsonLdContext"`
 	PayloadType        string            `json:"payloadType,omitempty" form:"payloadType"`
+	CbHost             string            `json:"cbHost,omitempty" form:"cbHost"`
+	Polling            *bool             `json:"polling,omitempty" form:"polling"`
+	StoreLastMeasure   *bool             `json:"storeLastMeasure,omitempty" form:"storeLastMeasure" since:"3.2.0"`
+	// LastMeasure is the last measure received from the device, set by the agent if StoreLastMeasure is enabled.
+	LastMeasure      json.RawMessage `json:"lastMeasure,omitempty" form:"lastMeasure" since:"3.2.0"`
+	UseCBflowControl *bool           `json:"useCBflowControl,omitempty" form:"useCBflowControl" since:"3.0.0"`
+	// Deprecated: ExpressionLanguage was removed in iotagent-node-lib 4.0.0, jexl is the only language.
+	ExpressionLanguage string `json:"expressionLanguage,omitempty" form:"expressionLanguage"`
+	// Extra holds the JSON members not modeled by the SDK.
+	Extra Extra `json:"-" form:"-"`
+	// Correlator is the fiware-correlator of the response the device was read from.
+	Correlator string `json:"-" form:"-"`
 }
 
-func (d *Device) MarshalJSON() ([]byte, error) {
+func (d *Device) setCorrelator(correlator string) { d.Correlator = correlator }
+
+// MarshalJSON encodes the device including Extra.
+// A nil ExplicitAttrs is omitted, so the agent keeps or defaults its value.
+func (d Device) MarshalJSON() ([]byte, error) {
+	data, err := d.marshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return withExtra(data, d.Extra)
+}
+
+func (d Device) marshalJSON() ([]byte, error) {
 	type Alias Device
 	switch v := d.ExplicitAttrs.(type) {
 	case string:
@@ -157,7 +231,7 @@ func (d *Device) MarshalJSON() ([]byte, error) {
 				*Alias
 			}{
 				ExplicitAttrs: tmp == "true",
-				Alias:         (*Alias)(d),
+				Alias:         (*Alias)(&d),
 			})
 		}
 
@@ -166,7 +240,7 @@ func (d *Device) MarshalJSON() ([]byte, error) {
 			*Alias
 		}{
 			ExplicitAttrs: v,
-			Alias:         (*Alias)(d),
+			Alias:         (*Alias)(&d),
 		})
 	case bool:
 		return json.Marshal(&struct {
@@ -174,15 +248,26 @@ func (d *Device) MarshalJSON() ([]byte, error) {
 			*Alias
 		}{
 			ExplicitAttrs: v,
-			Alias:         (*Alias)(d),
+			Alias:         (*Alias)(&d),
 		})
+	case nil:
+		return json.Marshal((*Alias)(&d))
 
 	default:
 		return nil, fmt.Errorf("ExplicitAttrs must be a string or a bool")
 	}
 }
 
-func (sa *StaticAttribute) MarshalJSON() ([]byte, error) {
+// MarshalJSON encodes the static attribute including Extra.
+func (sa StaticAttribute) MarshalJSON() ([]byte, error) {
+	data, err := sa.marshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return withExtra(data, sa.Extra)
+}
+
+func (sa StaticAttribute) marshalJSON() ([]byte, error) {
 	type Alias StaticAttribute
 	switch v := sa.Value.(type) {
 	// Logic for checking if it is indead a string
@@ -204,7 +289,7 @@ func (sa *StaticAttribute) MarshalJSON() ([]byte, error) {
 				*Alias
 			}{
 				Value: tmp,
-				Alias: (*Alias)(sa),
+				Alias: (*Alias)(&sa),
 			})
 		}
 		f, err := strconv.ParseFloat(v, 64)
@@ -214,7 +299,7 @@ func (sa *StaticAttribute) MarshalJSON() ([]byte, error) {
 				*Alias
 			}{
 				Value: f,
-				Alias: (*Alias)(sa),
+				Alias: (*Alias)(&sa),
 			})
 		}
 		i, err := strconv.ParseInt(v, 10, 64)
@@ -224,7 +309,7 @@ func (sa *StaticAttribute) MarshalJSON() ([]byte, error) {
 				*Alias
 			}{
 				Value: i,
-				Alias: (*Alias)(sa),
+				Alias: (*Alias)(&sa),
 			})
 		}
 		b, err := strconv.ParseBool(v)
@@ -234,7 +319,7 @@ func (sa *StaticAttribute) MarshalJSON() ([]byte, error) {
 				*Alias
 			}{
 				Value: b,
-				Alias: (*Alias)(sa),
+				Alias: (*Alias)(&sa),
 			})
 		}
 		return json.Marshal(&struct {
@@ -242,14 +327,14 @@ func (sa *StaticAttribute) MarshalJSON() ([]byte, error) {
 			*Alias
 		}{
 			Value: v,
-			Alias: (*Alias)(sa),
+			Alias: (*Alias)(&sa),
 		})
 	}
 	// Any other case just default marshalling
 	return json.Marshal(&struct {
 		*Alias
 	}{
-		Alias: (*Alias)(sa),
+		Alias: (*Alias)(&sa),
 	})
 
 }
@@ -24,7 +24,7 @@ func TestDevice_MarshalJSON(t *testing.T) {
 		StaticAttributes   []StaticAttribute
 		InternalAttributes []interface{}
 		ExplicitAttrs      any
-		NgsiVersion        string
+		NgsiVersion        NgsiVersion
 		PayloadType        string
 	}
 	tests := []struct {
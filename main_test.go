@@ -1,8 +1,10 @@
 package iotagentsdk_test
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	i "github.com/fbuedding/fiware-iot-agent-sdk"
 	"github.com/rs/zerolog"
@@ -26,6 +28,16 @@ const (
 	apiKey            = "testKey"
 )
 
+// newTestIoTA creates an IoTA for the IoT Agent at url, usually a httptest server, with opts.
+func newTestIoTA(t *testing.T, url string, opts ...i.Option) *i.IoTA {
+	t.Helper()
+	iotaTest, err := i.NewIoTAgentWithOptions("", 0, append([]i.Option{i.WithBaseURL(url)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return iotaTest
+}
+
 func TestMain(m *testing.M) {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
@@ -35,6 +47,12 @@ func TestMain(m *testing.M) {
 	}
 	log.Info().Msgf("Starting test with iot-agent host: %s", host)
 	iota = *i.NewIoTAgent(host, 4061, 1000)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	_, err := iota.WaitUntilReady(ctx, i.Backoff{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second, Multiplier: 2})
+	cancel()
+	if err != nil {
+		log.Fatal().Err(err).Msg("IoT Agent not ready for tests")
+	}
 	fs = i.FiwareService{Service: service, ServicePath: servicePath}
 	d = i.Device{
 		Id:                 deviceId,
@@ -81,7 +99,7 @@ func TestMain(m *testing.M) {
 		Endpoint:                     "",
 	}
 	iota.DeleteDevice(fs, d.Id)
-	err := iota.CreateDevice(fs, d)
+	err = iota.CreateDevice(fs, d)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Could not create device for tests")
 	}